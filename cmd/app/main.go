@@ -6,9 +6,12 @@ import (
 	"1CLogPumpClickHouse/internal/config"
 	"1CLogPumpClickHouse/internal/logger"
 	"1CLogPumpClickHouse/internal/models"
+	"1CLogPumpClickHouse/internal/quarantine"
+	"1CLogPumpClickHouse/internal/spool"
 	"1CLogPumpClickHouse/internal/storage"
 	"1CLogPumpClickHouse/internal/watcher"
 	"context"
+	"fmt"
 	"github.com/kardianos/service"
 	"go.uber.org/zap"
 	"os"
@@ -46,15 +49,39 @@ func (p *program) run() {
 	}
 	defer p.rootLogger.Sync()
 	p.rootLogger.Info("Сервис стартует…")
+	go func() {
+		select {
+		case <-p.sigCh:
+			p.rootLogger.Info("Получен сигнал завершения, останавливаем…")
+			p.cancel()
+		case <-p.ctx.Done():
+		}
+	}()
 
 	var store storage.ProcessedStore
-	if cfg.ProcessedStorage == "redis" {
+	switch cfg.ProcessedStorage {
+	case "redis":
 		store, err = storage.NewRedisStore(&cfg.Redis, "processed_files")
 		if err != nil {
 			p.rootLogger.Fatal("Ошибка подключения к Redis", zap.Error(err))
 		}
-	} else {
-		store = storage.NewFileStore("temp/processed_files.json")
+	case "bolt":
+		path := cfg.ProcessedStoragePath
+		if path == "" {
+			path = "temp/processed.db"
+		}
+		bs, err := storage.NewBoltStore(path)
+		if err != nil {
+			p.rootLogger.Fatal("Ошибка открытия базы смещений", zap.Error(err))
+		}
+		defer bs.Close()
+		store = bs
+	default:
+		path := cfg.ProcessedStoragePath
+		if path == "" {
+			path = "temp/processed_files.json"
+		}
+		store = storage.NewFileStore(path)
 	}
 
 	chLogger := p.rootLogger.Named("clickhouse")
@@ -64,6 +91,28 @@ func (p *program) run() {
 	}
 	defer chClient.Close()
 
+	if !cfg.ClickHouse.Schema.Manual {
+		// недоступный ClickHouse не останавливает сервис: миграция повторяется, пока он не ответит,
+		// а сервис завершается только при ошибке самой схемы
+		err := batch.WaitFor(p.ctx, cfg.ClickHouse.Retry, chLogger, func(ctx context.Context) error {
+			return clickhouseclient.Migrate(ctx, cfg, chLogger)
+		})
+		if p.ctx.Err() != nil {
+			p.rootLogger.Info("Сервис остановлен до миграции схемы ClickHouse")
+			return
+		}
+		if err != nil {
+			p.rootLogger.Fatal("Ошибка миграции схемы ClickHouse", zap.Error(err))
+		}
+	}
+
+	switch cfg.Quarantine.Mode {
+	case "clickhouse":
+		chClient.SetQuarantine(chClient.NewQuarantineSink(cfg.Quarantine.Table))
+	case "file":
+		chClient.SetQuarantine(quarantine.NewFileSink(cfg.Quarantine.Path))
+	}
+
 	batchCh := make(chan models.LogEntry, cfg.BatchSize*2)
 
 	wCfg := watcher.Config{
@@ -73,14 +122,41 @@ func (p *program) run() {
 		Store:      store,
 	}
 	w := watcher.New(wCfg, batchCh)
-	batcher := batch.NewBatcher(cfg.BatchSize, cfg.BatchInterval, p.rootLogger.Named("batcher"), chClient)
+	p.rootLogger.Info("Загружено состояние файлов", zap.Int("tracked", w.TrackedFiles()))
+	batcher := batch.NewBatcher(cfg.BatchSize, cfg.BatchInterval, cfg.ClickHouse.Retry, p.rootLogger.Named("batcher"), chClient)
+	if cfg.Spool.Enabled {
+		opts := spool.Options{MaxSegmentSize: 64 << 20, MaxSize: 1 << 30}
+		if cfg.Spool.MaxSegmentSize > 0 {
+			opts.MaxSegmentSize = int64(cfg.Spool.MaxSegmentSize) << 20
+		}
+		if cfg.Spool.MaxSize > 0 {
+			opts.MaxSize = int64(cfg.Spool.MaxSize) << 20
+		}
+		dir := cfg.Spool.Dir
+		if dir == "" {
+			dir = "temp/spool"
+		}
+		sp, err := spool.Open(dir, opts, p.rootLogger.Named("spool"))
+		if err != nil {
+			p.rootLogger.Fatal("Ошибка открытия спула", zap.Error(err))
+		}
+		defer sp.Close()
+		batcher.SetSpool(sp)
+	}
+	batcher.SetCommitter(w)
 
 	go w.Start(p.ctx)
-	go batcher.Run(p.ctx, batchCh)
-
-	<-p.sigCh
-	p.rootLogger.Info("Получен сигнал завершения, останавливаем…")
-	p.cancel()
+	batcherDone := make(chan struct{})
+	go func() {
+		batcher.Run(p.ctx, batchCh)
+		close(batcherDone)
+	}()
+
+	<-p.ctx.Done()
+	// дожидаемся последнего batch-а, прежде чем закрыть спул и соединение с ClickHouse
+	<-batcherDone
+	// состояние файлов, открытых после последней фиксации
+	w.SaveProcessed()
 	p.rootLogger.Info("Сервис завершён")
 }
 
@@ -91,6 +167,21 @@ func (p *program) Stop(s service.Service) error {
 	return nil
 }
 
+// migrate применяет миграции схемы ClickHouse и завершается (команда migrate)
+func migrate() error {
+	fixWorkingDir()
+	cfg, err := config.LoadConfig("config.yaml")
+	if err != nil {
+		return err
+	}
+	log, err := logger.InitZap(&cfg.Logging)
+	if err != nil {
+		return err
+	}
+	defer log.Sync()
+	return clickhouseclient.Migrate(context.Background(), cfg, log.Named("clickhouse"))
+}
+
 func fixWorkingDir() {
 	exePath, err := os.Executable()
 	if err != nil {
@@ -116,7 +207,15 @@ func main() {
 		panic(err)
 	}
 
-	// Обработка командной строки: install, start, stop, uninstall
+	// Обработка командной строки: migrate, install, start, stop, uninstall
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(); err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Схема ClickHouse обновлена")
+		return
+	}
 	if len(os.Args) > 1 {
 		err := service.Control(s, os.Args[1])
 		if err != nil {
@@ -2,8 +2,11 @@ package batch
 
 import (
 	"1CLogPumpClickHouse/internal/clickhouseclient"
+	"1CLogPumpClickHouse/internal/config"
 	"1CLogPumpClickHouse/internal/models"
+	"1CLogPumpClickHouse/internal/spool"
 	"context"
+	"errors"
 	"time"
 
 	"go.uber.org/zap"
@@ -12,39 +15,87 @@ import (
 // Batcher накапливает пачку логов и отправляет их в ClickHouse пачками
 // batchSize — сколько строк отправлять за раз
 // batchInterval — максимальный интервал между отправками (секунды)
+// Пока batch не отправлен, новые записи из канала не читаются: при недоступном
+// ClickHouse чтение файлов останавливается и ничего не теряется
 type Batcher struct {
 	batchSize     int
 	batchInterval time.Duration
 	logger        *zap.Logger
 	chClient      *clickhouseclient.Client
+	backoff       Backoff
+	breaker       *Breaker
+	maxElapsed    time.Duration // 0 — повторять до успеха
+	spool         *spool.Spool  // nil — batch отправляется сразу из памяти
+	committer     Committer     // nil — смещения не фиксируются
+}
+
+// Committer фиксирует обработанные смещения файлов (реализуется watcher-ом)
+type Committer interface {
+	Commit(offsets map[models.FileGen]int64)
 }
 
 // NewBatcher создает новый batcher
-func NewBatcher(batchSize int, batchInterval int, logger *zap.Logger, ch *clickhouseclient.Client) *Batcher {
+func NewBatcher(batchSize int, batchInterval int, retry config.RetryConfig, logger *zap.Logger, ch *clickhouseclient.Client) *Batcher {
+	backoff, breaker, maxElapsed := newRetry(retry)
 	return &Batcher{
 		batchSize:     batchSize,
 		batchInterval: time.Duration(batchInterval) * time.Second,
 		logger:        logger,
 		chClient:      ch,
+		backoff:       backoff,
+		breaker:       breaker,
+		maxElapsed:    maxElapsed,
 	}
 }
 
-// Run запускает сборку и отправку batch в ClickHouse
+// SetSpool включает дисковый буфер: собранные batch-и сначала пишутся в спул,
+// а отдельная горутина отправляет их в ClickHouse и подтверждает после вставки.
+// Пока ClickHouse недоступен, чтение продолжается до заполнения спула.
+func (b *Batcher) SetSpool(s *spool.Spool) {
+	b.spool = s
+}
+
+// SetCommitter задаёт, куда сообщать о доставленных записях. Смещения фиксируются
+// только после вставки batch-а в ClickHouse (или в карантин), а при включённом спуле —
+// после записи в спул: он сам повторит отправку после перезапуска.
+func (b *Batcher) SetCommitter(c Committer) {
+	b.committer = c
+}
+
+// Run запускает сборку и отправку batch в ClickHouse; возвращается после остановки ctx,
+// когда последний batch отправлен или записан в спул
 func (b *Batcher) Run(ctx context.Context, in <-chan models.LogEntry) {
 	batch := make([]models.LogEntry, 0, b.batchSize)
 	timer := time.NewTimer(b.batchInterval)
 	defer timer.Stop()
 
+	if b.spool != nil {
+		drained := make(chan struct{})
+		go func() {
+			b.drain(ctx)
+			close(drained)
+		}()
+		defer func() { <-drained }()
+	}
+
 	flush := func(reason string) {
 		if len(batch) == 0 {
 			return
 		}
+		if b.spool != nil {
+			// при остановке спул не ждёт места: batch записывается, если помещается
+			err := b.spool.Append(ctx, batch)
+			if err == nil {
+				b.logger.Debug("Batch записан в спул", zap.Int("count", len(batch)), zap.String("reason", reason))
+				b.commit(batch)
+				batch = batch[:0]
+				return
+			}
+			b.logger.Error("Не удалось записать batch в спул, отправляем напрямую", zap.Error(err))
+		}
 		b.logger.Info("Отправляем batch в ClickHouse", zap.Int("count", len(batch)), zap.String("reason", reason))
-		err := b.chClient.InsertTechLogBatch(ctx, batch)
-		if err != nil {
-			b.logger.Error("Ошибка при отправке batch в ClickHouse", zap.Error(err))
-		} else {
-			b.logger.Info("Batch успешно отправлен", zap.Int("count", len(batch)))
+		if b.send(ctx, batch) {
+			b.commit(batch)
 		}
 		batch = batch[:0]
 	}
@@ -66,3 +117,103 @@ func (b *Batcher) Run(ctx context.Context, in <-chan models.LogEntry) {
 		}
 	}
 }
+
+// drain отправляет batch-и из спула по порядку и подтверждает их после вставки.
+// Неотправленные при остановке batch-и остаются в спуле до следующего запуска.
+func (b *Batcher) drain(ctx context.Context) {
+	for {
+		id, batch, err := b.spool.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				b.logger.Error("Чтение спула остановлено", zap.Error(err))
+			}
+			return
+		}
+		b.logger.Info("Отправляем batch из спула в ClickHouse", zap.Int("count", len(batch)))
+		if !b.send(ctx, batch) {
+			return
+		}
+		if err := b.spool.Ack(id); err != nil {
+			b.logger.Error("Не удалось подтвердить batch в спуле", zap.Error(err))
+		}
+	}
+}
+
+// commit сообщает committer-у, до какого смещения обработан каждый файл batch-а
+func (b *Batcher) commit(batch []models.LogEntry) {
+	if b.committer == nil {
+		return
+	}
+	offsets := make(map[models.FileGen]int64)
+	for _, e := range batch {
+		if e.File == "" {
+			continue
+		}
+		key := models.FileGen{File: e.File, Gen: e.Gen}
+		if end, ok := offsets[key]; !ok || e.End > end {
+			offsets[key] = e.End
+		}
+	}
+	b.committer.Commit(offsets)
+}
+
+// send отправляет batch, повторяя вставку при временных ошибках.
+// При неустранимой ошибке (схема, типы данных) batch уходит в карантин; пока карантин
+// не записан, batch повторяется и не считается отправленным.
+// Возвращает false, если batch не отправлен из-за остановки сервиса.
+func (b *Batcher) send(ctx context.Context, batch []models.LogEntry) bool {
+	start, count := time.Now(), len(batch)
+	for attempt := 0; ; attempt++ {
+		if wait := b.breaker.Wait(time.Now()); wait > 0 {
+			sleep(ctx, wait)
+		}
+		err := b.chClient.InsertTechLogBatch(ctx, batch)
+		if err == nil {
+			if b.breaker.Success() {
+				b.logger.Info("ClickHouse снова доступен, отправка возобновлена")
+			}
+			b.logger.Info("Batch успешно отправлен", zap.Int("count", count), zap.Int("attempts", attempt+1))
+			return true
+		}
+		var partial *clickhouseclient.PartialError
+		if errors.As(err, &partial) {
+			// часть таблиц уже записана: повторяем только остаток, чтобы не дублировать строки
+			batch = partial.Remaining
+		}
+		if !clickhouseclient.IsRetryable(err) {
+			b.logger.Error("Неустранимая ошибка вставки, batch уходит в карантин", zap.Int("count", len(batch)), zap.Error(err))
+			if err = b.chClient.QuarantineBatch(ctx, batch, err.Error()); err == nil {
+				return true
+			}
+			// карантин не записан: batch повторяется, как после временной ошибки
+		} else if b.maxElapsed > 0 && time.Since(start) > b.maxElapsed {
+			b.logger.Error("Batch не отправлен за отведённое время, уходит в карантин",
+				zap.Int("count", len(batch)), zap.Duration("elapsed", time.Since(start)), zap.Error(err))
+			if err = b.chClient.QuarantineBatch(ctx, batch, err.Error()); err == nil {
+				return true
+			}
+		}
+		if b.breaker.Failure(time.Now()) {
+			b.logger.Error("ClickHouse недоступен, чтение новых записей приостановлено",
+				zap.Duration("cooldown", b.breaker.Cooldown), zap.Error(err))
+		}
+		if ctx.Err() != nil {
+			b.logger.Error("Batch не отправлен при остановке сервиса", zap.Int("count", len(batch)), zap.Error(err))
+			return false
+		}
+		delay := b.backoff.Delay(attempt)
+		b.logger.Warn("Ошибка при отправке batch в ClickHouse, повтор",
+			zap.Int("attempt", attempt+1), zap.Duration("delay", delay), zap.Error(err))
+		sleep(ctx, delay)
+	}
+}
+
+// sleep ждёт d или отмены ctx
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,154 @@
+package batch
+
+import (
+	"1CLogPumpClickHouse/internal/clickhouseclient"
+	"1CLogPumpClickHouse/internal/config"
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Backoff — экспоненциальная пауза между повторами со случайным разбросом,
+// чтобы несколько сервисов не возобновляли вставку одновременно
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// Delay возвращает паузу перед повтором номер attempt (с нуля)
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt))
+	if d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	d *= 1 + b.Jitter*(2*rand.Float64()-1)
+	return time.Duration(d)
+}
+
+// Breaker — автомат размыкания цепи: после Threshold неудач подряд ClickHouse
+// считается недоступным, и следующая попытка делается не раньше чем через Cooldown.
+// Вставки идут из двух горутин (сборка batch-ей и отправка из спула), поэтому состояние под mu.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time // нулевое значение — цепь замкнута
+}
+
+// Failure учитывает неудачную вставку; возвращает true, если цепь только что разомкнулась
+func (br *Breaker) Failure(now time.Time) bool {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.failures++
+	if br.failures < br.Threshold {
+		return false
+	}
+	wasOpen := br.isOpen()
+	br.openedAt = now
+	return !wasOpen
+}
+
+// Success замыкает цепь; возвращает true, если до этого она была разомкнута
+func (br *Breaker) Success() bool {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	wasOpen := br.isOpen()
+	br.failures = 0
+	br.openedAt = time.Time{}
+	return wasOpen
+}
+
+// Open сообщает, разомкнута ли цепь
+func (br *Breaker) Open() bool {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	return br.isOpen()
+}
+
+// isOpen — Open под уже захваченным br.mu
+func (br *Breaker) isOpen() bool {
+	return !br.openedAt.IsZero()
+}
+
+// Wait возвращает, сколько ждать до пробной вставки (0 — цепь замкнута или пауза истекла)
+func (br *Breaker) Wait(now time.Time) time.Duration {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if !br.isOpen() {
+		return 0
+	}
+	if d := br.openedAt.Add(br.Cooldown).Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// newRetry заполняет значения по умолчанию для незаданных параметров
+func newRetry(cfg config.RetryConfig) (Backoff, *Breaker, time.Duration) {
+	b := Backoff{
+		Initial:    time.Duration(cfg.InitialIntervalMs) * time.Millisecond,
+		Max:        time.Duration(cfg.MaxInterval) * time.Second,
+		Multiplier: cfg.Multiplier,
+		Jitter:     cfg.Jitter,
+	}
+	if b.Initial == 0 {
+		b.Initial = 500 * time.Millisecond
+	}
+	if b.Max == 0 {
+		b.Max = time.Minute
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = 2
+	}
+	switch {
+	case cfg.Jitter < 0:
+		b.Jitter = 0
+	case cfg.Jitter == 0:
+		b.Jitter = 0.2
+	}
+	br := &Breaker{
+		Threshold: cfg.BreakerThreshold,
+		Cooldown:  time.Duration(cfg.BreakerCooldown) * time.Second,
+	}
+	if br.Threshold == 0 {
+		br.Threshold = 5
+	}
+	if br.Cooldown == 0 {
+		br.Cooldown = 30 * time.Second
+	}
+	return b, br, time.Duration(cfg.MaxElapsed) * time.Second
+}
+
+// WaitFor выполняет fn (например, миграцию схемы при запуске), повторяя её с паузами и автоматом
+// размыкания цепи из настроек Retry, пока ошибка временная (см. clickhouseclient.IsRetryable):
+// недоступный при запуске ClickHouse не останавливает сервис. Возвращает nil после успеха,
+// постоянную ошибку — сразу, ошибку ctx — при остановке сервиса. MaxElapsed не учитывается.
+func WaitFor(ctx context.Context, cfg config.RetryConfig, logger *zap.Logger, fn func(context.Context) error) error {
+	backoff, breaker, _ := newRetry(cfg)
+	for attempt := 0; ; attempt++ {
+		if wait := breaker.Wait(time.Now()); wait > 0 {
+			sleep(ctx, wait)
+		}
+		err := fn(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil || !clickhouseclient.IsRetryable(err) {
+			return err
+		}
+		if breaker.Failure(time.Now()) {
+			logger.Error("ClickHouse недоступен", zap.Duration("cooldown", breaker.Cooldown), zap.Error(err))
+		}
+		delay := backoff.Delay(attempt)
+		logger.Warn("ClickHouse недоступен, повтор", zap.Int("attempt", attempt+1), zap.Duration("delay", delay), zap.Error(err))
+		sleep(ctx, delay)
+	}
+}
@@ -0,0 +1,100 @@
+package batch
+
+import (
+	"1CLogPumpClickHouse/internal/clickhouseclient"
+	"1CLogPumpClickHouse/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestNewRetryJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter float64
+		want   float64
+	}{
+		{"по умолчанию", 0, 0.2},
+		{"задан", 0.5, 0.5},
+		{"выключен", -1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _, _ := newRetry(config.RetryConfig{Jitter: tt.jitter})
+			if b.Jitter != tt.want {
+				t.Errorf("Jitter = %v, want %v", b.Jitter, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffDelayWithoutJitter(t *testing.T) {
+	b, _, _ := newRetry(config.RetryConfig{InitialIntervalMs: 100, MaxInterval: 1, Jitter: -1})
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for attempt, d := range want {
+		if got := b.Delay(attempt); got != d {
+			t.Errorf("Delay(%d) = %v, want %v", attempt, got, d)
+		}
+	}
+}
+
+func TestBreakerConcurrentUse(t *testing.T) {
+	// сборка batch-ей и отправка из спула пользуются одним автоматом (проверяется с -race)
+	br := &Breaker{Threshold: 3, Cooldown: time.Second}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			br.Failure(time.Now())
+			br.Wait(time.Now())
+		}
+		close(done)
+	}()
+	for i := 0; i < 1000; i++ {
+		br.Success()
+		br.Open()
+	}
+	<-done
+	for i := 0; i < 3; i++ {
+		br.Failure(time.Now())
+	}
+	if !br.Open() {
+		t.Error("цепь не разомкнулась после Threshold неудач")
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	cfg := config.RetryConfig{InitialIntervalMs: 1, MaxInterval: 1, Jitter: -1}
+	calls := 0
+	err := WaitFor(context.Background(), cfg, zap.NewNop(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("dial tcp 127.0.0.1:9000: connect: connection refused")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("сетевая ошибка: err = %v, попыток %d, want 3", err, calls)
+	}
+
+	calls = 0
+	err = WaitFor(context.Background(), cfg, zap.NewNop(), func(context.Context) error {
+		calls++
+		return fmt.Errorf("migration 1: %w", clickhouseclient.ErrPermanent)
+	})
+	if !errors.Is(err, clickhouseclient.ErrPermanent) || calls != 1 {
+		t.Errorf("ошибка схемы: err = %v, попыток %d, want 1", err, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = WaitFor(ctx, cfg, zap.NewNop(), func(context.Context) error {
+		cancel()
+		return errors.New("connection refused")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("после остановки err = %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package charset
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Encoding — кодировка лог-файла
+type Encoding struct {
+	Name      string
+	unit      int  // размер кодовой единицы: 1 байт или 2 для UTF-16
+	bigEndian bool // порядок байт UTF-16
+	enc       encoding.Encoding
+}
+
+var (
+	UTF8    = Encoding{Name: "utf-8", unit: 1}
+	UTF16LE = Encoding{Name: "utf-16le", unit: 2, enc: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)}
+	UTF16BE = Encoding{Name: "utf-16be", unit: 2, bigEndian: true, enc: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)}
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// Lookup возвращает кодировку по имени: utf-8 (по умолчанию для пустого имени),
+// utf-16le, utf-16be или однобайтовая кодовая страница по имени IANA (windows-1251, cp866, koi8-r…)
+func Lookup(name string) (Encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "utf-8", "utf8":
+		return UTF8, nil
+	case "utf-16le", "utf-16":
+		return UTF16LE, nil
+	case "utf-16be":
+		return UTF16BE, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil || enc == nil {
+		return Encoding{}, fmt.Errorf("неизвестная кодировка %q", name)
+	}
+	// перевод строки должен кодироваться одним байтом 0x0A, иначе строки не разрезать
+	if nl, err := enc.NewEncoder().Bytes([]byte("\n")); err != nil || !bytes.Equal(nl, []byte("\n")) {
+		return Encoding{}, fmt.Errorf("неизвестная кодировка %q", name)
+	}
+	return Encoding{Name: strings.ToLower(name), unit: 1, enc: enc}, nil
+}
+
+// Sniff определяет кодировку по BOM в начале файла.
+// Возвращает кодировку, длину BOM и false, если BOM нет.
+func Sniff(head []byte) (Encoding, int, bool) {
+	switch {
+	case bytes.HasPrefix(head, bomUTF8):
+		return UTF8, len(bomUTF8), true
+	case bytes.HasPrefix(head, bomUTF16LE):
+		return UTF16LE, len(bomUTF16LE), true
+	case bytes.HasPrefix(head, bomUTF16BE):
+		return UTF16BE, len(bomUTF16BE), true
+	}
+	return Encoding{}, 0, false
+}
+
+// maybeBOM сообщает, что прочитанного начала файла пока не хватает, чтобы исключить BOM
+func maybeBOM(head []byte) bool {
+	if len(head) >= len(bomUTF8) {
+		return false
+	}
+	return bytes.HasPrefix(bomUTF8, head) || bytes.HasPrefix(bomUTF16LE, head) || bytes.HasPrefix(bomUTF16BE, head)
+}
+
+// decode переводит строку из кодировки файла в UTF-8
+func (e Encoding) decode(raw []byte) string {
+	if e.enc == nil {
+		return string(raw)
+	}
+	out, err := e.enc.NewDecoder().Bytes(raw)
+	if err != nil {
+		return string(raw)
+	}
+	return string(out)
+}
+
+// Line — строка файла в UTF-8 без перевода строки.
+// Size — сколько байт строка занимала в файле вместе с переводом строки (и BOM для первой строки).
+type Line struct {
+	Text string
+	Size int64
+}
+
+// Splitter режет поток байт файла на строки и декодирует их в UTF-8.
+// Перевод строки ищется по кодовым единицам, поэтому в UTF-16 байт 0x0A
+// внутри символа (например, «Њ» = 0A 04) не разрывает строку.
+type Splitter struct {
+	enc   Encoding
+	sniff bool // чтение с начала файла: кодировку определяет BOM
+	skip  int  // длина BOM, ещё не учтённая в размере строки
+	buf   []byte
+	pos   int
+}
+
+// NewSplitter создаёт разделитель строк. fallback — кодировка для файлов без BOM;
+// atStart — чтение идёт с начала файла, и BOM нужно определить и пропустить.
+func NewSplitter(fallback Encoding, atStart bool) *Splitter {
+	return &Splitter{enc: fallback, sniff: atStart}
+}
+
+// Encoding возвращает кодировку, которой декодируется файл
+func (s *Splitter) Encoding() Encoding {
+	return s.enc
+}
+
+// Write добавляет прочитанные из файла байты
+func (s *Splitter) Write(p []byte) {
+	if s.pos > 0 && s.pos == len(s.buf) {
+		s.buf, s.pos = s.buf[:0], 0
+	} else if s.pos > len(s.buf)/2 {
+		s.buf = append(s.buf[:0], s.buf[s.pos:]...)
+		s.pos = 0
+	}
+	s.buf = append(s.buf, p...)
+}
+
+// Next возвращает следующую полную строку; незавершённый хвост остаётся в буфере
+func (s *Splitter) Next() (Line, bool) {
+	if s.sniff {
+		head := s.buf[s.pos:]
+		if maybeBOM(head) {
+			return Line{}, false
+		}
+		if enc, n, ok := Sniff(head); ok {
+			s.enc, s.skip = enc, n
+			s.pos += n
+		}
+		s.sniff = false
+	}
+
+	data := s.buf[s.pos:]
+	end := -1
+	if s.enc.unit == 2 {
+		hi, lo := 1, 0
+		if s.enc.bigEndian {
+			hi, lo = 0, 1
+		}
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i+lo] == '\n' && data[i+hi] == 0 {
+				end = i + 2
+				break
+			}
+		}
+	} else if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		end = i + 1
+	}
+	if end < 0 {
+		return Line{}, false
+	}
+
+	raw := data[:end-s.enc.unit]
+	line := Line{Text: s.enc.decode(raw), Size: int64(end + s.skip)}
+	s.skip = 0
+	s.pos += end
+	return line, true
+}
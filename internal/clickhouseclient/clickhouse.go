@@ -3,11 +3,15 @@ package clickhouseclient
 import (
 	"1CLogPumpClickHouse/internal/config"
 	"1CLogPumpClickHouse/internal/models"
+	"1CLogPumpClickHouse/internal/quarantine"
 	"1CLogPumpClickHouse/internal/transform"
 	"context"
 	"fmt"
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"go.uber.org/zap"
+	"hash/fnv"
+	"sort"
+	"strconv"
 	"time"
 )
 
@@ -24,110 +28,395 @@ type Config struct {
 }
 
 type Client struct {
-	conn         clickhouse.Conn
-	DefaultTable string
-	TableMap     map[string]string
-	Logger       *zap.Logger
+	conn          clickhouse.Conn
+	shards        []clickhouse.Conn // Cluster.Mode "shards": соединения с шардами, строки раскладываются по ShardingKey
+	shardWeights  []uint64          // веса шардов в порядке shards, как в remote_servers
+	shardingKey   string
+	cluster       config.ClusterConfig
+	settings      clickhouse.Settings // настройки каждого INSERT
+	health        []*health
+	stopHealth    context.CancelFunc
+	DefaultTable  string
+	TableMap      map[string]string
+	EventLogTable string
+	Logger        *zap.Logger
+	quarantine    quarantine.Sink
+}
+
+// SetQuarantine задаёт приёмник для записей с ошибками разбора и преобразования.
+// Без приёмника такие записи только логируются.
+func (c *Client) SetQuarantine(sink quarantine.Sink) {
+	c.quarantine = sink
 }
 
-// New создает клиента ClickHouse
+// New создает клиента ClickHouse: пул соединений с репликами из Address/Addresses,
+// а для Cluster.Mode "shards" — отдельный пул на каждый шард
 func New(cfg config.ClickHouseConfig, logger *zap.Logger) (*Client, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		cluster:       cfg.Cluster,
+		shardingKey:   cfg.Cluster.ShardingKey,
+		settings:      clickhouse.Settings{},
+		stopHealth:    cancel,
+		DefaultTable:  cfg.DefaultTable,
+		TableMap:      cfg.TableMap,
+		EventLogTable: cfg.EventLogTable,
+		Logger:        logger,
+	}
+	conn, err := c.open(ctx, cfg, cfg.Addrs())
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("clickhouse open: %w", err)
+	}
+	c.conn = conn
+	switch cfg.Cluster.Mode {
+	case "distributed":
+		// Distributed-таблица по умолчанию отвечает до записи на шарды: ошибка шарда
+		// не дошла бы до клиента, и batch не был бы повторён
+		c.settings["insert_distributed_sync"] = 1
+	case "shards":
+		for i, addrs := range cfg.Cluster.Shards {
+			conn, err := c.open(ctx, cfg, addrs)
+			if err != nil {
+				c.Close()
+				return nil, fmt.Errorf("clickhouse open shard %d: %w", i+1, err)
+			}
+			c.shards = append(c.shards, conn)
+			c.shardWeights = append(c.shardWeights, cfg.Cluster.ShardWeight(i))
+		}
+	}
+	return c, nil
+}
+
+// open открывает пул соединений с репликами addrs. Если реплик несколько,
+// они периодически проверяются, и недоступные пропускаются при подключении.
+func (c *Client) open(ctx context.Context, cfg config.ClickHouseConfig, addrs []string) (clickhouse.Conn, error) {
+	opts, err := options(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts.Addr = addrs
+	if len(addrs) > 1 && cfg.HealthCheckInterval >= 0 {
+		interval := defaultHealthCheckInterval
+		if cfg.HealthCheckInterval > 0 {
+			interval = time.Duration(cfg.HealthCheckInterval) * time.Second
+		}
+		h, err := newHealth(opts, c.Logger)
+		if err != nil {
+			return nil, err
+		}
+		c.health = append(c.health, h)
+		opts.DialStrategy = h.dialStrategy
+		go h.run(ctx, interval)
+	}
+	return clickhouse.Open(opts)
+}
+
+// options собирает параметры подключения из конфигурации
+func options(cfg config.ClickHouseConfig) (*clickhouse.Options, error) {
+	tlsConfig, err := cfg.TLS.Build()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
 	protocol := clickhouse.Native
 	if cfg.Protocol == "http" {
 		protocol = clickhouse.HTTP
 	}
-
-	conn, err := clickhouse.Open(&clickhouse.Options{
-		Addr: []string{cfg.Address},
+	strategy := clickhouse.ConnOpenInOrder
+	switch cfg.ConnStrategy {
+	case "round_robin":
+		strategy = clickhouse.ConnOpenRoundRobin
+	case "random":
+		strategy = clickhouse.ConnOpenRandom
+	}
+	return &clickhouse.Options{
+		Addr: cfg.Addrs(),
 		Auth: clickhouse.Auth{
 			Database: cfg.Database,
 			Username: cfg.Username,
 			Password: cfg.Password,
 		},
-		DialTimeout: 5 * time.Second,
-		Compression: &clickhouse.Compression{Method: clickhouse.CompressionLZ4},
-		Protocol:    protocol,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("clickhouse open: %w", err)
-	}
-	return &Client{
-		conn:         conn,
-		DefaultTable: cfg.DefaultTable,
-		TableMap:     cfg.TableMap,
-		Logger:       logger,
+		DialTimeout:      5 * time.Second,
+		Compression:      &clickhouse.Compression{Method: clickhouse.CompressionLZ4},
+		Protocol:         protocol,
+		ConnOpenStrategy: strategy,
+		TLS:              tlsConfig, // для HTTP включает https
 	}, nil
 }
 
-// InsertTechLogBatch конвертирует LogEntry в TechLogRow через transform и отправляет в ClickHouse
+// PartialError — вставка прервалась на одной из таблиц: записи остальных таблиц уже
+// отправлены, повторять нужно только Remaining
+type PartialError struct {
+	Remaining []models.LogEntry
+	Err       error
+}
+
+func (e *PartialError) Error() string { return e.Err.Error() }
+
+func (e *PartialError) Unwrap() error { return e.Err }
+
+// InsertTechLogBatch конвертирует LogEntry в TechLogRow через transform и отправляет в ClickHouse.
+// Записи журнала регистрации (LogEntry.EventLog) уходят в EventLogTable.
+// Записи с ошибками разбора и преобразования сразу уходят в карантин; если карантин не записан,
+// возвращается ошибка и batch не считается доставленным. При ошибке вставки
+// возвращается *PartialError с записями, которые ещё не отправлены.
 func (c *Client) InsertTechLogBatch(ctx context.Context, entries []models.LogEntry) error {
-	// Группируем записи по имени таблицы
+	// Группируем записи по имени таблицы: TableMap сопоставляет имя события (DBMSSQL, EXCP, ...) с таблицей
 	grouped := make(map[string][]models.LogEntry)
+	rows := make(map[string][]models.TechLogRow)
+	var quarantined []quarantine.Record
+	var eventLogs []models.LogEntry
 	for _, entry := range entries {
+		if entry.ParseError != "" {
+			quarantined = append(quarantined, quarantineRecord(entry, entry.ParseError))
+			continue
+		}
+		if entry.EventLog != nil {
+			eventLogs = append(eventLogs, entry)
+			continue
+		}
+		row, err := transform.TransformLogEntry(entry)
+		if err != nil {
+			quarantined = append(quarantined, quarantineRecord(entry, err.Error()))
+			continue // пропускаем эту запись, не останавливая весь цикл
+		}
 		tableName := c.DefaultTable
-		if tbl, ok := c.TableMap[entry.Component]; ok {
+		if tbl, ok := c.TableMap[entry.EventName]; ok {
 			tableName = tbl
 		}
 		grouped[tableName] = append(grouped[tableName], entry)
+		rows[tableName] = append(rows[tableName], row)
+	}
+	if err := c.writeQuarantine(ctx, quarantined); err != nil {
+		// ничего ещё не вставлено: batch повторяется целиком, и нераспознанные записи не теряются
+		return err
 	}
 
 	// Отправляем отдельный батч для каждой таблицы
-	for tableName, group := range grouped {
-		// Используем отдельный контекст с таймаутом, чтобы отмена сервиса не прерывала операцию
-		dbCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-
-		batch, err := c.conn.PrepareBatch(dbCtx,
-			"INSERT INTO "+tableName+" ("+
-				"EventDate, EventTime, EventType, Duration, User, InfoBase, SessionID, "+
-				"ClientID, ConnectionID, ExceptionType, ErrorText, SQLText, Rows, RowsAffected, Context, ProcessName"+
-				") VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)")
-		if err != nil {
-			cancel()
-			c.Logger.Error("prepare batch", zap.Error(err), zap.String("table", tableName))
-			return fmt.Errorf("prepare batch: %w", err)
+	tables := make([]string, 0, len(grouped))
+	for tableName := range grouped {
+		tables = append(tables, tableName)
+	}
+	sort.Strings(tables)
+	for i, tableName := range tables {
+		if err := c.insertTechLogRows(tableName, rows[tableName], dedupToken(grouped[tableName])); err != nil {
+			remaining := append([]models.LogEntry(nil), eventLogs...)
+			for _, rest := range tables[i:] {
+				remaining = append(remaining, grouped[rest]...)
+			}
+			return &PartialError{Remaining: remaining, Err: err}
 		}
+	}
 
-		for _, entry := range group {
-			row, err := transform.TransformLogEntry(entry)
-			if err != nil {
-				c.Logger.Warn("Некорректное время события, запись пропущена", zap.Error(err), zap.Any("entry", entry))
-				continue // пропускаем эту запись, не останавливая весь цикл
-			}
-			if err := batch.Append(
-				row.EventDate,
-				row.EventTime,
-				row.EventType,
-				row.Duration,
-				row.User,
-				row.InfoBase,
-				row.SessionID,
-				row.ClientID,
-				row.ConnectionID,
-				row.ExceptionType,
-				row.ErrorText,
-				row.SQLText,
-				row.Rows,
-				row.RowsAffected,
-				row.Context,
-				row.ProcessName,
-			); err != nil {
-				cancel()
-				c.Logger.Error("append batch", zap.Error(err), zap.Any("row", row))
-				return fmt.Errorf("append: %w", err)
-			}
+	if len(eventLogs) > 0 {
+		if err := c.insertEventLogBatch(eventLogs); err != nil {
+			return &PartialError{Remaining: eventLogs, Err: err}
 		}
+	}
+	return nil
+}
+
+// insertTechLogRows отправляет строки техжурнала в таблицу tableName одним INSERT,
+// а в режиме шардов — по INSERT в локальную таблицу каждого шарда
+func (c *Client) insertTechLogRows(tableName string, rows []models.TechLogRow, token string) error {
+	if c.shards == nil {
+		return c.sendTechLogRows(c.conn, tableName, rows, token)
+	}
+	parts := make([][]models.TechLogRow, len(c.shards))
+	for _, row := range rows {
+		i := c.shardOf(techLogShardKey(c.shardingKey, row))
+		parts[i] = append(parts[i], row)
+	}
+	for i, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+		// раскладка по шардам детерминирована, поэтому при повторе после сбоя другого шарда
+		// уже записанная часть отбрасывается по тому же токену
+		if err := c.sendTechLogRows(c.shards[i], c.cluster.LocalTable(tableName), part, token+"-"+strconv.Itoa(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendTechLogRows выполняет INSERT строк техжурнала через соединение conn
+func (c *Client) sendTechLogRows(conn clickhouse.Conn, tableName string, rows []models.TechLogRow, token string) error {
+	// Используем отдельный контекст с таймаутом, чтобы отмена сервиса не прерывала операцию
+	dbCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	dbCtx = c.insertContext(dbCtx, token)
+
+	batch, err := conn.PrepareBatch(dbCtx,
+		"INSERT INTO "+tableName+" ("+
+			"EventDate, EventTime, EventType, Duration, User, InfoBase, SessionID, "+
+			"ClientID, ConnectionID, ExceptionType, ErrorText, SQLText, Rows, RowsAffected, Context, ProcessName, Properties, "+
+			"LockRegions, Locks, WaitConnections, DeadlockVictim, DeadlockParticipants, DeadlockIntersections, "+
+			"CallInterface, CallMethod, CpuTime, Memory, MemoryPeak, InBytes, OutBytes, "+
+			"SQLNormalized, SQLHash, ContextFirstLine, ContextLastLine, ContextFrames, "+
+			"PlanSQLText, PlanScans, PlanSeeks, PlanEstimatedRows"+
+			") VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		c.Logger.Error("prepare batch", zap.Error(err), zap.String("table", tableName))
+		return fmt.Errorf("prepare batch: %w", err)
+	}
+
+	for _, row := range rows {
+		if err := batch.Append(
+			row.EventDate,
+			row.EventTime,
+			row.EventType,
+			row.Duration,
+			row.User,
+			row.InfoBase,
+			row.SessionID,
+			row.ClientID,
+			row.ConnectionID,
+			row.ExceptionType,
+			row.ErrorText,
+			row.SQLText,
+			row.Rows,
+			row.RowsAffected,
+			row.Context,
+			row.ProcessName,
+			row.Properties,
+			row.LockRegions,
+			row.Locks,
+			row.WaitConnections,
+			row.DeadlockVictim,
+			row.DeadlockParticipants,
+			row.DeadlockIntersections,
+			row.CallInterface,
+			row.CallMethod,
+			row.CpuTime,
+			row.Memory,
+			row.MemoryPeak,
+			row.InBytes,
+			row.OutBytes,
+			row.SQLNormalized,
+			row.SQLHash,
+			row.ContextFirstLine,
+			row.ContextLastLine,
+			row.ContextFrames,
+			row.PlanSQLText,
+			row.PlanScans,
+			row.PlanSeeks,
+			row.PlanEstimatedRows,
+		); err != nil {
+			c.Logger.Error("append batch", zap.Error(err), zap.Any("row", row))
+			return fmt.Errorf("append: %w: %w", ErrPermanent, err)
+		}
+	}
+
+	if err := batch.Send(); err != nil {
+		c.Logger.Error("send batch", zap.Error(err), zap.String("table", tableName))
+		return fmt.Errorf("send batch: %w", err)
+	}
+	return nil
+}
+
+// dedupToken строит insert_deduplication_token только из файлов, поколений их чтения и диапазонов
+// смещений записей (файл, поколение, начало первой записи, конец последней, число записей), не завися
+// от их порядка в batch-е: повтор тех же записей (ретрай, повторная отправка из спула, перечитывание
+// после сбоя) получает тот же токен, и ClickHouse не вставляет блок второй раз. Поколение сохраняется
+// вместе со смещением и меняется, когда файл усечён или заменён: те же диапазоны нового содержимого
+// получают другой токен и не отбрасываются как дубликаты.
+func dedupToken(entries []models.LogEntry) string {
+	type segment struct {
+		start, end int64
+		count      int
+	}
+	segments := make(map[models.FileGen]*segment)
+	for _, e := range entries {
+		key := models.FileGen{File: e.File, Gen: e.Gen}
+		seg, ok := segments[key]
+		if !ok {
+			segments[key] = &segment{start: e.Offset, end: e.End, count: 1}
+			continue
+		}
+		seg.start, seg.end = min(seg.start, e.Offset), max(seg.end, e.End)
+		seg.count++
+	}
+	keys := make([]models.FileGen, 0, len(segments))
+	for key := range segments {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].File != keys[j].File {
+			return keys[i].File < keys[j].File
+		}
+		return keys[i].Gen < keys[j].Gen
+	})
+	h := fnv.New64a()
+	for _, key := range keys {
+		seg := segments[key]
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00%d\x00%d\n", key.File, key.Gen, seg.start, seg.end, seg.count)
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// insertContext добавляет к запросу настройки вставки и токен дедупликации (если задан)
+func (c *Client) insertContext(ctx context.Context, token string) context.Context {
+	settings := make(clickhouse.Settings, len(c.settings)+1)
+	for k, v := range c.settings {
+		settings[k] = v
+	}
+	if token != "" {
+		settings["insert_deduplication_token"] = token
+	}
+	return clickhouse.Context(ctx, clickhouse.WithSettings(settings))
+}
 
-		if err := batch.Send(); err != nil {
-			cancel() // отменяем контекст при ошибке
-			c.Logger.Error("send batch", zap.Error(err), zap.String("table", tableName))
-			return fmt.Errorf("send batch: %w", err)
+// QuarantineBatch отправляет в карантин записи, которые не удалось вставить (неустранимая ошибка).
+// Ошибка означает, что записи не сохранены ни в таблице, ни в карантине.
+func (c *Client) QuarantineBatch(ctx context.Context, entries []models.LogEntry, reason string) error {
+	records := make([]quarantine.Record, 0, len(entries))
+	for _, entry := range entries {
+		records = append(records, quarantineRecord(entry, reason))
+	}
+	return c.writeQuarantine(ctx, records)
+}
+
+// writeQuarantine отправляет нераспознанные записи в карантин
+func (c *Client) writeQuarantine(ctx context.Context, records []quarantine.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if c.quarantine == nil {
+		for _, r := range records {
+			c.Logger.Warn("Запись пропущена", zap.String("file", r.File), zap.Int64("offset", r.Offset), zap.String("reason", r.Reason))
 		}
-		cancel()
+		return nil
+	}
+	if err := c.quarantine.Write(ctx, records); err != nil {
+		c.Logger.Error("Не удалось записать карантин", zap.Int("count", len(records)), zap.Error(err))
+		return fmt.Errorf("write quarantine: %w", err)
 	}
+	c.Logger.Info("Записи отправлены в карантин", zap.Int("count", len(records)))
 	return nil
 }
 
-// Close закрывает соединение с ClickHouse
+func quarantineRecord(entry models.LogEntry, reason string) quarantine.Record {
+	return quarantine.Record{
+		Time:   time.Now(),
+		File:   entry.File,
+		Offset: entry.Offset,
+		Reason: reason,
+		Raw:    entry.Raw,
+	}
+}
+
+// Close останавливает проверку реплик и закрывает соединения с ClickHouse
 func (c *Client) Close() error {
+	c.stopHealth()
+	for _, h := range c.health {
+		h.close()
+	}
+	for _, conn := range c.shards {
+		conn.Close()
+	}
+	if c.conn == nil {
+		return nil
+	}
 	return c.conn.Close()
 }
@@ -0,0 +1,59 @@
+package clickhouseclient
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"1CLogPumpClickHouse/internal/quarantine"
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestDedupToken(t *testing.T) {
+	a := models.LogEntry{File: "/logs/rphost_1/25052607.log", Offset: 0, End: 100}
+	b := models.LogEntry{File: "/logs/rphost_1/25052607.log", Offset: 100, End: 250}
+	c := models.LogEntry{File: "/logs/rphost_2/25052607.log", Offset: 40, End: 90}
+
+	base := dedupToken([]models.LogEntry{a, b, c})
+	if got := dedupToken([]models.LogEntry{c, b, a}); got != base {
+		t.Errorf("токен зависит от порядка записей: %s != %s", got, base)
+	}
+	// файл усечён или заменён: те же диапазоны в новом поколении не должны совпасть с прежними
+	a.Gen, b.Gen = 7, 7
+	if got := dedupToken([]models.LogEntry{a, b, c}); got == base {
+		t.Error("токен не изменился для нового поколения файла")
+	}
+	a.Gen, b.Gen = 0, 0
+	if got := dedupToken([]models.LogEntry{a, b}); got == base {
+		t.Error("токен не изменился без записей второго файла")
+	}
+	if got := dedupToken([]models.LogEntry{a, c}); got == base {
+		t.Error("токен не изменился для другого диапазона смещений")
+	}
+}
+
+// failingSink — карантин, запись в который не проходит (например, ClickHouse недоступен)
+type failingSink struct{ calls int }
+
+func (s *failingSink) Write(context.Context, []quarantine.Record) error {
+	s.calls++
+	return errors.New("dial tcp 127.0.0.1:9000: connect: connection refused")
+}
+
+func TestQuarantineFailureFailsBatch(t *testing.T) {
+	sink := &failingSink{}
+	c := &Client{Logger: zap.NewNop()}
+	c.SetQuarantine(sink)
+	entries := []models.LogEntry{{File: "/logs/25052607.log", Raw: "broken", ParseError: "unterminated quote"}}
+	err := c.InsertTechLogBatch(context.Background(), entries)
+	if err == nil || sink.calls != 1 {
+		t.Fatalf("ошибка карантина не вернулась: err = %v, попыток записи %d", err, sink.calls)
+	}
+	if !IsRetryable(err) {
+		t.Errorf("недоступный карантин считается неустранимой ошибкой: %v", err)
+	}
+	if err := c.QuarantineBatch(context.Background(), entries, "schema"); err == nil {
+		t.Error("QuarantineBatch не вернул ошибку карантина")
+	}
+}
@@ -0,0 +1,54 @@
+package clickhouseclient
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// ErrPermanent помечает ошибки, которые не исчезнут при повторе (данные не подходят к схеме таблицы)
+var ErrPermanent = errors.New("неустранимая ошибка вставки")
+
+// retryableCodes — коды исключений ClickHouse, после которых вставку стоит повторить:
+// сервер перегружен, перезапускается или временно недоступна реплика
+var retryableCodes = map[int32]bool{
+	3:   true, // UNEXPECTED_END_OF_FILE
+	159: true, // TIMEOUT_EXCEEDED
+	164: true, // READONLY
+	202: true, // TOO_MANY_SIMULTANEOUS_QUERIES
+	203: true, // NO_FREE_CONNECTION
+	209: true, // SOCKET_TIMEOUT
+	210: true, // NETWORK_ERROR
+	241: true, // MEMORY_LIMIT_EXCEEDED
+	242: true, // TABLE_IS_READ_ONLY
+	252: true, // TOO_MANY_PARTS
+	319: true, // UNKNOWN_STATUS_OF_INSERT
+	425: true, // SYSTEM_ERROR
+	999: true, // KEEPER_EXCEPTION
+}
+
+// httpCodeRegex — код исключения в тексте ошибки HTTP-протокола
+var httpCodeRegex = regexp.MustCompile(`[Cc]ode: (\d+)`)
+
+// IsRetryable сообщает, стоит ли повторить вставку после ошибки err.
+// Сетевые ошибки и перегрузка сервера временные; исключения о схеме
+// (нет таблицы или колонки, несовпадение типов), права доступа и ошибки
+// преобразования данных — постоянные.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, ErrPermanent) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var ex *clickhouse.Exception
+	if errors.As(err, &ex) {
+		return retryableCodes[ex.Code]
+	}
+	if m := httpCodeRegex.FindStringSubmatch(err.Error()); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return retryableCodes[int32(code)]
+	}
+	// нет ответа сервера: обрыв соединения, отказ в подключении, таймаут
+	return true
+}
@@ -0,0 +1,97 @@
+package clickhouseclient
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"go.uber.org/zap"
+)
+
+// insertEventLogBatch отправляет записи журнала регистрации в EventLogTable,
+// а в режиме шардов — в её локальные таблицы на шардах
+func (c *Client) insertEventLogBatch(entries []models.LogEntry) error {
+	if c.EventLogTable == "" {
+		return fmt.Errorf("prepare eventlog batch: %w: EventLogTable не задана", ErrPermanent)
+	}
+	if c.shards == nil {
+		return c.sendEventLogBatch(c.conn, c.EventLogTable, entries)
+	}
+	parts := make([][]models.LogEntry, len(c.shards))
+	for _, entry := range entries {
+		i := c.shardOf(eventLogShardKey(c.shardingKey, entry.EventLog))
+		parts[i] = append(parts[i], entry)
+	}
+	for i, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+		if err := c.sendEventLogBatch(c.shards[i], c.cluster.LocalTable(c.EventLogTable), part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendEventLogBatch выполняет INSERT записей журнала регистрации в table через соединение conn
+func (c *Client) sendEventLogBatch(conn clickhouse.Conn, table string, entries []models.LogEntry) error {
+	dbCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	dbCtx = c.insertContext(dbCtx, dedupToken(entries))
+
+	batch, err := conn.PrepareBatch(dbCtx,
+		"INSERT INTO "+table+" ("+
+			"EventDate, EventTime, InfoBase, TransactionStatus, TransactionTime, TransactionNumber, "+
+			"User, UserUUID, Computer, Application, Connection, Event, Severity, Comment, "+
+			"Metadata, MetadataUUID, Data, DataPresentation, Server, MainPort, SecondPort, Session, File"+
+			") VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		c.Logger.Error("prepare eventlog batch", zap.Error(err), zap.String("table", table))
+		return fmt.Errorf("prepare eventlog batch: %w", err)
+	}
+
+	for _, entry := range entries {
+		r := entry.EventLog
+		eventDate := time.Date(r.EventTime.Year(), r.EventTime.Month(), r.EventTime.Day(), 0, 0, 0, 0, time.UTC)
+		var txTime *time.Time // вне транзакции время не задано
+		if !r.TransactionTime.IsZero() {
+			txTime = &r.TransactionTime
+		}
+		if err := batch.Append(
+			eventDate,
+			r.EventTime,
+			r.InfoBase,
+			r.TransactionStatus,
+			txTime,
+			r.TransactionNumber,
+			r.User,
+			r.UserUUID,
+			r.Computer,
+			r.Application,
+			r.Connection,
+			r.Event,
+			r.Severity,
+			r.Comment,
+			r.Metadata,
+			r.MetadataUUID,
+			r.Data,
+			r.DataPresentation,
+			r.Server,
+			r.MainPort,
+			r.SecondPort,
+			r.Session,
+			entry.File,
+		); err != nil {
+			c.Logger.Error("append eventlog batch", zap.Error(err))
+			return fmt.Errorf("append eventlog: %w: %w", ErrPermanent, err)
+		}
+	}
+
+	if err := batch.Send(); err != nil {
+		c.Logger.Error("send eventlog batch", zap.Error(err), zap.String("table", table))
+		return fmt.Errorf("send eventlog batch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package clickhouseclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"go.uber.org/zap"
+)
+
+// defaultHealthCheckInterval — период проверки реплик, если HealthCheckInterval не задан
+const defaultHealthCheckInterval = 15 * time.Second
+
+// health периодически проверяет реплики пингом и помнит недоступные.
+// Новые соединения открываются сначала к доступным репликам (в порядке ConnStrategy),
+// недоступные пробуются последними — на случай, если проверка ещё не заметила восстановления.
+type health struct {
+	logger *zap.Logger
+	probes map[string]clickhouse.Conn // отдельное соединение на каждую реплику
+
+	mu   sync.RWMutex
+	down map[string]bool
+}
+
+// newHealth готовит проверку реплик из opts.Addr; соединения устанавливаются при первом пинге
+func newHealth(opts *clickhouse.Options, logger *zap.Logger) (*health, error) {
+	h := &health{
+		logger: logger,
+		probes: make(map[string]clickhouse.Conn, len(opts.Addr)),
+		down:   make(map[string]bool),
+	}
+	for _, addr := range opts.Addr {
+		o := *opts
+		o.Addr = []string{addr}
+		o.MaxOpenConns, o.MaxIdleConns = 1, 1
+		o.DialStrategy = nil
+		conn, err := clickhouse.Open(&o)
+		if err != nil {
+			h.close()
+			return nil, err
+		}
+		h.probes[addr] = conn
+	}
+	return h, nil
+}
+
+// run проверяет реплики каждые interval до отмены ctx
+func (h *health) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		h.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check пингует все реплики и логирует смену их состояния
+func (h *health) check(ctx context.Context) {
+	for addr, conn := range h.probes {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := conn.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		h.mu.Lock()
+		wasDown := h.down[addr]
+		h.down[addr] = err != nil
+		h.mu.Unlock()
+		switch {
+		case err != nil && !wasDown:
+			h.logger.Warn("Реплика ClickHouse недоступна", zap.String("addr", addr), zap.Error(err))
+		case err == nil && wasDown:
+			h.logger.Info("Реплика ClickHouse снова доступна", zap.String("addr", addr))
+		}
+	}
+}
+
+// split делит реплики на доступные и недоступные, сохраняя их порядок
+func (h *health) split(addrs []string) (up, down []string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, addr := range addrs {
+		if h.down[addr] {
+			down = append(down, addr)
+		} else {
+			up = append(up, addr)
+		}
+	}
+	return up, down
+}
+
+// dialStrategy — DialStrategy клиента: реплика выбирается по ConnStrategy среди доступных,
+// недоступные пробуются, только если не удалось подключиться ни к одной доступной
+func (h *health) dialStrategy(ctx context.Context, connID int, opts *clickhouse.Options, dial clickhouse.Dial) (r clickhouse.DialResult, err error) {
+	o := *opts
+	up, down := h.split(opts.Addr)
+	for _, addrs := range [][]string{up, down} {
+		if len(addrs) == 0 {
+			continue
+		}
+		o.Addr = addrs
+		if r, err = clickhouse.DefaultDialStrategy(ctx, connID, &o, dial); err == nil {
+			return r, nil
+		}
+	}
+	return r, err
+}
+
+func (h *health) close() {
+	for _, conn := range h.probes {
+		conn.Close()
+	}
+}
@@ -0,0 +1,458 @@
+package clickhouseclient
+
+import (
+	"1CLogPumpClickHouse/internal/config"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"go.uber.org/zap"
+)
+
+// tableKind — вид таблицы, к которому относится миграция
+type tableKind int
+
+const (
+	kindTechLog tableKind = iota
+	kindQuarantine
+	kindEventLog
+)
+
+// column — колонка таблицы: имя и тип ClickHouse
+type column struct {
+	Name string
+	Type string
+}
+
+// schema — параметры создания таблиц из ClickHouse.Schema с подставленными значениями по умолчанию
+type schema struct {
+	Engine      string
+	PartitionBy string
+	OrderBy     string
+	TTL         string
+	TimeZone    string
+	Cluster     string // имя кластера для ON CLUSTER; пусто — DDL только на подключённом узле
+}
+
+// migration — версия схемы. Версии сквозные для всех видов таблиц,
+// к таблице применяются миграции её вида с версией больше уже применённой.
+// Новые колонки добавляются только новыми миграциями: уже выпущенные не меняются.
+type migration struct {
+	Version     uint32
+	Kind        tableKind
+	Description string
+	Up          func(table string, s schema) []string
+}
+
+var migrations = []migration{
+	{1, kindTechLog, "таблица техжурнала", func(table string, s schema) []string {
+		return []string{createTable(table, []column{
+			{"EventDate", "Date"},
+			{"EventTime", s.dateTime(6)},
+			{"EventType", "LowCardinality(String)"},
+			{"Duration", "UInt32"},
+			{"User", "String"},
+			{"InfoBase", "String"},
+			{"SessionID", "UInt32"},
+			{"ClientID", "UInt32"},
+			{"ConnectionID", "UInt32"},
+			{"ExceptionType", "Nullable(String)"},
+			{"ErrorText", "Nullable(String)"},
+			{"SQLText", "Nullable(String)"},
+			{"Rows", "Nullable(Int32)"},
+			{"RowsAffected", "Nullable(Int32)"},
+			{"Context", "Nullable(String)"},
+			{"ProcessName", "String"},
+		}, s.Engine, s.partitionBy("EventDate"), s.orderBy("(EventDate, EventTime)"), s.TTL)}
+	}},
+	{2, kindTechLog, "свойства записи, длительность в микросекундах", func(table string, s schema) []string {
+		return []string{
+			addColumns(table, []column{{"Properties", "Map(String, String)"}}),
+			"ALTER TABLE " + table + " MODIFY COLUMN Duration UInt64",
+		}
+	}},
+	{3, kindTechLog, "поля блокировок, взаимоблокировок и вызовов", func(table string, s schema) []string {
+		return []string{addColumns(table, []column{
+			{"LockRegions", "Array(String)"},
+			{"Locks", "String"},
+			{"WaitConnections", "Array(UInt32)"},
+			{"DeadlockVictim", "UInt32"},
+			{"DeadlockParticipants", "Array(UInt32)"},
+			{"DeadlockIntersections", "String"},
+			{"CallInterface", "LowCardinality(String)"},
+			{"CallMethod", "LowCardinality(String)"},
+			{"CpuTime", "UInt64"},
+			{"Memory", "Int64"},
+			{"MemoryPeak", "Int64"},
+			{"InBytes", "UInt64"},
+			{"OutBytes", "UInt64"},
+		})}
+	}},
+	{4, kindTechLog, "нормализованный SQL и его хеш", func(table string, s schema) []string {
+		return []string{addColumns(table, []column{
+			{"SQLNormalized", "String"},
+			{"SQLHash", "UInt64"},
+		})}
+	}},
+	{5, kindTechLog, "кадры контекста", func(table string, s schema) []string {
+		return []string{addColumns(table, []column{
+			{"ContextFirstLine", "String"},
+			{"ContextLastLine", "String"},
+			{"ContextFrames", "Array(String)"},
+		})}
+	}},
+	{6, kindTechLog, "план запроса", func(table string, s schema) []string {
+		return []string{addColumns(table, []column{
+			{"PlanSQLText", "String"},
+			{"PlanScans", "UInt32"},
+			{"PlanSeeks", "UInt32"},
+			{"PlanEstimatedRows", "Float64"},
+		})}
+	}},
+	{7, kindQuarantine, "таблица карантина", func(table string, s schema) []string {
+		return []string{createTable(table, []column{
+			{"InsertedAt", "DateTime64(6)"},
+			{"File", "String"},
+			{"Offset", "Int64"},
+			{"Reason", "String"},
+			{"Raw", "String"},
+		}, s.Engine, "", "InsertedAt", "")}
+	}},
+	{8, kindEventLog, "таблица журнала регистрации", func(table string, s schema) []string {
+		return []string{createTable(table, []column{
+			{"EventDate", "Date"},
+			{"EventTime", s.dateTime(0)},
+			{"InfoBase", "LowCardinality(String)"},
+			{"TransactionStatus", "LowCardinality(String)"},
+			{"TransactionTime", "Nullable(" + s.dateTime(4) + ")"},
+			{"TransactionNumber", "UInt64"},
+			{"User", "LowCardinality(String)"},
+			{"UserUUID", "String"},
+			{"Computer", "LowCardinality(String)"},
+			{"Application", "LowCardinality(String)"},
+			{"Connection", "UInt64"},
+			{"Event", "LowCardinality(String)"},
+			{"Severity", "LowCardinality(String)"},
+			{"Comment", "String"},
+			{"Metadata", "LowCardinality(String)"},
+			{"MetadataUUID", "String"},
+			{"Data", "String"},
+			{"DataPresentation", "String"},
+			{"Server", "LowCardinality(String)"},
+			{"MainPort", "UInt32"},
+			{"SecondPort", "UInt32"},
+			{"Session", "UInt64"},
+			{"File", "String"},
+		}, s.Engine, s.partitionBy("toYYYYMM(EventDate)"), "(InfoBase, EventTime)", s.TTL)}
+	}},
+	{9, kindTechLog, "дедупликация вставок по insert_deduplication_token", deduplicationWindow},
+	{10, kindEventLog, "дедупликация вставок по insert_deduplication_token", deduplicationWindow},
+	{11, kindTechLog, "SessionID без усечения до 32 бит", func(table string, s schema) []string {
+		// значение совпадает с разобранным из записи, и выражение шардирования SessionID
+		// выбирает тот же шард, что и сервис в режиме shards
+		return []string{"ALTER TABLE " + table + " MODIFY COLUMN SessionID UInt64"}
+	}},
+}
+
+// deduplicationWindow включает дедупликацию блоков для нереплицируемых MergeTree.
+// У Replicated*MergeTree она включена по умолчанию, а настройка к ним не относится.
+func deduplicationWindow(table string, s schema) []string {
+	if s.replicated() {
+		return nil
+	}
+	return []string{"ALTER TABLE " + table + " MODIFY SETTING non_replicated_deduplication_window = 1000"}
+}
+
+// replicated сообщает, что таблицы создаются реплицируемым движком (Replicated*MergeTree)
+func (s schema) replicated() bool {
+	return strings.HasPrefix(s.Engine, "Replicated")
+}
+
+// migrationsEngine возвращает движок таблицы миграций table. DDL в кластере идёт ON CLUSTER,
+// поэтому таблица реплицируется на все узлы, и каждый видит одни и те же применённые версии
+func (s schema) migrationsEngine(table string) string {
+	if s.Cluster == "" {
+		return "MergeTree"
+	}
+	return fmt.Sprintf("ReplicatedMergeTree('/clickhouse/%s/%s', '{replica}')", s.Cluster, table)
+}
+
+// dateTime возвращает тип DateTime/DateTime64 с часовым поясом серверов 1С
+func (s schema) dateTime(precision int) string {
+	tz := ""
+	if s.TimeZone != "" {
+		tz = "'" + s.TimeZone + "'"
+	}
+	if precision == 0 {
+		return "DateTime(" + tz + ")"
+	}
+	if tz != "" {
+		tz = ", " + tz
+	}
+	return fmt.Sprintf("DateTime64(%d%s)", precision, tz)
+}
+
+// onCluster возвращает " ON CLUSTER <имя>" или пустую строку без кластера
+func (s schema) onCluster() string {
+	if s.Cluster == "" {
+		return ""
+	}
+	return " ON CLUSTER " + s.Cluster
+}
+
+func (s schema) partitionBy(def string) string {
+	if s.PartitionBy != "" {
+		return s.PartitionBy
+	}
+	return def
+}
+
+func (s schema) orderBy(def string) string {
+	if s.OrderBy != "" {
+		return s.OrderBy
+	}
+	return def
+}
+
+// createTable строит CREATE TABLE IF NOT EXISTS: таблицу, созданную вручную, миграция не трогает
+func createTable(table string, columns []column, engine, partitionBy, orderBy, ttl string) string {
+	var b strings.Builder
+	b.WriteString("CREATE TABLE IF NOT EXISTS " + table + " (\n")
+	for i, c := range columns {
+		b.WriteString("    " + c.Name + " " + c.Type)
+		if i < len(columns)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(")\nENGINE = " + engine)
+	if partitionBy != "" {
+		b.WriteString("\nPARTITION BY " + partitionBy)
+	}
+	b.WriteString("\nORDER BY " + orderBy)
+	if ttl != "" {
+		b.WriteString("\nTTL " + ttl)
+	}
+	return b.String()
+}
+
+// addColumns строит ALTER TABLE … ADD COLUMN IF NOT EXISTS
+func addColumns(table string, columns []column) string {
+	parts := make([]string, len(columns))
+	for i, c := range columns {
+		parts[i] = "ADD COLUMN IF NOT EXISTS " + c.Name + " " + c.Type
+	}
+	return "ALTER TABLE " + table + " " + strings.Join(parts, ", ")
+}
+
+// migrationTarget — таблица из конфигурации и её вид
+type migrationTarget struct {
+	Table string
+	Kind  tableKind
+}
+
+// migrationTargets перечисляет таблицы, которые пишет сервис:
+// DefaultTable и TableMap, таблица карантина и журнала регистрации
+func migrationTargets(cfg *config.Config) []migrationTarget {
+	var targets []migrationTarget
+	seen := make(map[string]bool)
+	add := func(table string, kind tableKind) {
+		if table == "" || seen[table] {
+			return
+		}
+		seen[table] = true
+		targets = append(targets, migrationTarget{Table: table, Kind: kind})
+	}
+	add(cfg.ClickHouse.DefaultTable, kindTechLog)
+	for _, table := range cfg.ClickHouse.TableMap {
+		add(table, kindTechLog)
+	}
+	if cfg.Quarantine.Mode == "clickhouse" {
+		add(cfg.Quarantine.Table, kindQuarantine)
+	}
+	add(cfg.ClickHouse.EventLogTable, kindEventLog)
+	return targets
+}
+
+// Migrate создаёт базу данных и применяет недостающие миграции ко всем таблицам сервиса.
+// Применённые версии хранятся в Schema.MigrationsTable (по таблицам), поэтому
+// таблица, добавленная в TableMap позже, получает все миграции с начала.
+func Migrate(ctx context.Context, cfg *config.Config, logger *zap.Logger) error {
+	opts, err := options(cfg.ClickHouse)
+	if err != nil {
+		return fmt.Errorf("clickhouse options: %w: %w", ErrPermanent, err)
+	}
+	db := opts.Auth.Database
+	// база может ещё не существовать: подключаемся к базе пользователя по умолчанию
+	opts.Auth.Database = ""
+	// без кластера таблица миграций хранится на узле, поэтому всегда подключаемся к первому доступному по списку
+	opts.ConnOpenStrategy = clickhouse.ConnOpenInOrder
+	conn, err := clickhouse.Open(opts)
+	if err != nil {
+		return fmt.Errorf("clickhouse open: %w", err)
+	}
+	defer conn.Close()
+
+	sc := cfg.ClickHouse.Schema
+	cl := cfg.ClickHouse.Cluster
+	s := schema{
+		Engine:      sc.Engine,
+		PartitionBy: sc.PartitionBy,
+		OrderBy:     sc.OrderBy,
+		TTL:         sc.TTL,
+		TimeZone:    cfg.TimeZone,
+		Cluster:     cl.Name,
+	}
+	if s.Engine == "" {
+		s.Engine = "MergeTree"
+	}
+	migrationsTable := sc.MigrationsTable
+	if migrationsTable == "" {
+		migrationsTable = "schema_migrations"
+	}
+	migrationsTable = db + "." + migrationsTable
+	// в режимах distributed и shards данные лежат в локальных таблицах шардов,
+	// а таблицы из конфигурации становятся Distributed-таблицами над ними
+	distributed := cl.Mode == "distributed" || cl.Mode == "shards"
+
+	if err := conn.Exec(ctx, "CREATE DATABASE IF NOT EXISTS "+db+s.onCluster()); err != nil {
+		return fmt.Errorf("create database: %w", err)
+	}
+	if err := conn.Exec(ctx, createTable(migrationsTable+s.onCluster(), []column{
+		{"TableName", "String"},
+		{"Version", "UInt32"},
+		{"Description", "String"},
+		{"AppliedAt", "DateTime"},
+	}, s.migrationsEngine(migrationsTable), "", "(TableName, Version)", "")); err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+
+	applied, err := appliedVersions(ctx, conn, migrationsTable)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range migrationTargets(cfg) {
+		local := t.Table
+		if distributed {
+			local = cl.LocalTable(t.Table)
+		}
+		// ON CLUSTER во всех DDL миграций идёт сразу после имени таблицы
+		table := db + "." + local + s.onCluster()
+		for _, m := range migrations {
+			if m.Kind != t.Kind || m.Version <= applied[local] {
+				continue
+			}
+			for _, stmt := range m.Up(table, s) {
+				if err := conn.Exec(ctx, stmt); err != nil {
+					return fmt.Errorf("migration %d (%s): %w", m.Version, local, err)
+				}
+			}
+			if err := conn.Exec(ctx, "INSERT INTO "+migrationsTable+" (TableName, Version, Description, AppliedAt) VALUES (?, ?, ?, now())",
+				local, m.Version, m.Description); err != nil {
+				return fmt.Errorf("record migration %d (%s): %w", m.Version, local, err)
+			}
+			logger.Info("Применена миграция схемы", zap.String("table", local),
+				zap.Uint32("version", m.Version), zap.String("description", m.Description))
+		}
+		if distributed {
+			if err := syncDistributed(ctx, conn, db, local, t.Table, s, shardingExpr(cl.ShardingKey, t.Kind)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// shardingExpr возвращает выражение шардирования Distributed-таблицы по ShardingKey
+func shardingExpr(key string, kind tableKind) string {
+	switch {
+	case kind == kindQuarantine:
+		return "rand()"
+	case key == "User":
+		return "cityHash64(User)"
+	case key == "Session" && kind == kindEventLog:
+		return "Session"
+	case key == "Session":
+		return "SessionID"
+	}
+	return "cityHash64(InfoBase)"
+}
+
+// syncDistributed создаёт Distributed-таблицу dist над локальной таблицей local
+// и добавляет в неё колонки, появившиеся в локальной таблице после миграций
+func syncDistributed(ctx context.Context, conn clickhouse.Conn, db, local, dist string, s schema, shardingKey string) error {
+	if err := conn.Exec(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s.%s%s AS %s.%s ENGINE = Distributed(%s, %s, %s, %s)",
+		db, dist, s.onCluster(), db, local, s.Cluster, db, local, shardingKey)); err != nil {
+		return fmt.Errorf("create distributed table %s: %w", dist, err)
+	}
+	localColumns, err := tableColumns(ctx, conn, db, local)
+	if err != nil {
+		return err
+	}
+	distColumns, err := tableColumns(ctx, conn, db, dist)
+	if err != nil {
+		return err
+	}
+	types := make(map[string]string, len(distColumns))
+	for _, c := range distColumns {
+		types[c.Name] = c.Type
+	}
+	var alters []string
+	for _, c := range localColumns {
+		typ, ok := types[c.Name]
+		switch {
+		case !ok:
+			alters = append(alters, "ADD COLUMN IF NOT EXISTS "+c.Name+" "+c.Type)
+		case typ != c.Type:
+			alters = append(alters, "MODIFY COLUMN "+c.Name+" "+c.Type)
+		}
+	}
+	if len(alters) == 0 {
+		return nil
+	}
+	if err := conn.Exec(ctx, "ALTER TABLE "+db+"."+dist+s.onCluster()+" "+strings.Join(alters, ", ")); err != nil {
+		return fmt.Errorf("alter distributed table %s: %w", dist, err)
+	}
+	return nil
+}
+
+// tableColumns читает колонки таблицы из system.columns в порядке их следования
+func tableColumns(ctx context.Context, conn clickhouse.Conn, db, table string) ([]column, error) {
+	rows, err := conn.Query(ctx, "SELECT name, type FROM system.columns WHERE database = ? AND table = ? ORDER BY position", db, table)
+	if err != nil {
+		return nil, fmt.Errorf("read columns %s: %w", table, err)
+	}
+	defer rows.Close()
+	var columns []column
+	for rows.Next() {
+		var c column
+		if err := rows.Scan(&c.Name, &c.Type); err != nil {
+			return nil, fmt.Errorf("scan columns %s: %w", table, err)
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// appliedVersions возвращает последнюю применённую версию по каждой таблице
+func appliedVersions(ctx context.Context, conn clickhouse.Conn, migrationsTable string) (map[string]uint32, error) {
+	rows, err := conn.Query(ctx, "SELECT TableName, max(Version) FROM "+migrationsTable+" GROUP BY TableName")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := make(map[string]uint32)
+	for rows.Next() {
+		var (
+			table   string
+			version uint32
+		)
+		if err := rows.Scan(&table, &version); err != nil {
+			return nil, fmt.Errorf("scan migrations: %w", err)
+		}
+		applied[table] = version
+	}
+	return applied, rows.Err()
+}
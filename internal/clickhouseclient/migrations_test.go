@@ -0,0 +1,27 @@
+package clickhouseclient
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeduplicationWindowDependsOnEngine(t *testing.T) {
+	if got := deduplicationWindow("logs_db.logs", schema{Engine: "MergeTree"}); len(got) != 1 ||
+		!strings.Contains(got[0], "non_replicated_deduplication_window") {
+		t.Errorf("MergeTree: %v", got)
+	}
+	engine := "ReplicatedMergeTree('/clickhouse/tables/{shard}/logs', '{replica}')"
+	if got := deduplicationWindow("logs_db.logs ON CLUSTER c", schema{Engine: engine}); len(got) != 0 {
+		t.Errorf("ReplicatedMergeTree: %v", got)
+	}
+}
+
+func TestMigrationsEngine(t *testing.T) {
+	if got := (schema{}).migrationsEngine("logs_db.schema_migrations"); got != "MergeTree" {
+		t.Errorf("без кластера: %s", got)
+	}
+	want := "ReplicatedMergeTree('/clickhouse/logs_cluster/logs_db.schema_migrations', '{replica}')"
+	if got := (schema{Cluster: "logs_cluster"}).migrationsEngine("logs_db.schema_migrations"); got != want {
+		t.Errorf("в кластере: %s, want %s", got, want)
+	}
+}
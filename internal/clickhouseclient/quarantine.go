@@ -0,0 +1,41 @@
+package clickhouseclient
+
+import (
+	"1CLogPumpClickHouse/internal/quarantine"
+	"context"
+	"fmt"
+	"time"
+)
+
+// QuarantineSink пишет записи карантина в таблицу ClickHouse:
+// InsertedAt DateTime64(6), File String, Offset Int64, Reason String, Raw String
+type QuarantineSink struct {
+	client *Client
+	table  string
+}
+
+// NewQuarantineSink создаёт приёмник карантина в таблице table
+func (c *Client) NewQuarantineSink(table string) *QuarantineSink {
+	return &QuarantineSink{client: c, table: table}
+}
+
+func (s *QuarantineSink) Write(ctx context.Context, records []quarantine.Record) error {
+	dbCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	dbCtx = s.client.insertContext(dbCtx, "")
+
+	batch, err := s.client.conn.PrepareBatch(dbCtx,
+		"INSERT INTO "+s.table+" (InsertedAt, File, Offset, Reason, Raw) VALUES (?,?,?,?,?)")
+	if err != nil {
+		return fmt.Errorf("prepare quarantine batch: %w", err)
+	}
+	for _, r := range records {
+		if err := batch.Append(r.Time, r.File, r.Offset, r.Reason, r.Raw); err != nil {
+			return fmt.Errorf("append quarantine: %w: %w", ErrPermanent, err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("send quarantine batch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package clickhouseclient
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+
+	"github.com/go-faster/city"
+)
+
+// shardOf выбирает шард так же, как Distributed-таблица: значение выражения шардирования
+// берётся по модулю суммы весов, и шард определяется по диапазону, который занимает его вес
+func (c *Client) shardOf(key uint64) int {
+	var total uint64
+	for _, w := range c.shardWeights {
+		total += w
+	}
+	slot := key % total
+	for i, w := range c.shardWeights {
+		if slot < w {
+			return i
+		}
+		slot -= w
+	}
+	return len(c.shardWeights) - 1
+}
+
+// techLogShardKey вычисляет выражение шардирования Distributed-таблицы (shardingExpr) для строки техжурнала:
+// cityHash64(InfoBase), cityHash64(User) или SessionID
+func techLogShardKey(key string, row models.TechLogRow) uint64 {
+	switch key {
+	case "User":
+		return city.CH64([]byte(row.User))
+	case "Session":
+		return row.SessionID
+	}
+	return city.CH64([]byte(row.InfoBase))
+}
+
+// eventLogShardKey вычисляет выражение шардирования для записи журнала регистрации
+func eventLogShardKey(key string, r *models.EventLogRecord) uint64 {
+	switch key {
+	case "User":
+		return city.CH64([]byte(r.User))
+	case "Session":
+		return r.Session
+	}
+	return city.CH64([]byte(r.InfoBase))
+}
@@ -0,0 +1,37 @@
+package clickhouseclient
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"testing"
+)
+
+func TestShardKey(t *testing.T) {
+	// значения SELECT cityHash64('Moscow'), cityHash64('') из ClickHouse
+	row := models.TechLogRow{InfoBase: "Moscow", User: "", SessionID: 1<<32 + 42}
+	if got := techLogShardKey("InfoBase", row); got != 12507901496292878638 {
+		t.Errorf("cityHash64(InfoBase) = %d", got)
+	}
+	if got := techLogShardKey("User", row); got != 11160318154034397263 {
+		t.Errorf("cityHash64(User) = %d", got)
+	}
+	if got := techLogShardKey("Session", row); got != 1<<32+42 {
+		t.Errorf("SessionID = %d", got)
+	}
+	r := &models.EventLogRecord{InfoBase: "Moscow", Session: 7}
+	if got := eventLogShardKey("", r); got != 12507901496292878638 {
+		t.Errorf("cityHash64(InfoBase) = %d", got)
+	}
+	if got := eventLogShardKey("Session", r); got != 7 {
+		t.Errorf("Session = %d", got)
+	}
+}
+
+func TestShardOf(t *testing.T) {
+	// веса 1, 0, 3: слот 0 — первый шард, слоты 1–3 — третий, второй не получает строк
+	c := &Client{shardWeights: []uint64{1, 0, 3}}
+	for key, want := range map[uint64]int{0: 0, 1: 2, 3: 2, 4: 0, 5: 2, 12507901496292878638: 2} {
+		if got := c.shardOf(key); got != want {
+			t.Errorf("shardOf(%d) = %d, ожидался %d", key, got, want)
+		}
+	}
+}
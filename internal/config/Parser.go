@@ -1,10 +1,13 @@
 package config
 
 import (
+	"1CLogPumpClickHouse/internal/charset"
 	"bytes"
 	"fmt"
 	"gopkg.in/yaml.v3"
 	"os"
+	"regexp"
+	"time"
 )
 
 // readFile читает все байты из файла по пути
@@ -36,8 +39,25 @@ func parseYAML(data []byte) (*Config, error) {
 
 // Validate проверяет обязательные поля конфигурации
 func (c *Config) Validate() error {
-	if len(c.LogDirectoryMap) == 0 {
-		return fmt.Errorf("LogDirectoryMap must not be empty")
+	if len(c.LogDirectoryMap) == 0 && len(c.EventLogDirectoryMap) == 0 {
+		return fmt.Errorf("LogDirectoryMap or EventLogDirectoryMap must not be empty")
+	}
+	if len(c.EventLogDirectoryMap) > 0 && c.ClickHouse.EventLogTable == "" {
+		return fmt.Errorf("ClickHouse.EventLogTable must not be empty when EventLogDirectoryMap is set")
+	}
+	for key, pc := range c.Parsers {
+		if _, ok := c.LogDirectoryMap[key]; !ok {
+			return fmt.Errorf("Parsers.%s: no such key in LogDirectoryMap", key)
+		}
+		switch pc.Type {
+		case "", "techlog", "jsonl":
+		case "regex":
+			if _, err := regexp.Compile(pc.Pattern); err != nil || pc.Pattern == "" {
+				return fmt.Errorf("Parsers.%s: Pattern must be a valid regular expression", key)
+			}
+		default:
+			return fmt.Errorf("Parsers.%s: Type must be techlog, jsonl or regex", key)
+		}
 	}
 	if c.FilePattern == "" {
 		return fmt.Errorf("FilePattern must not be empty")
@@ -48,11 +68,104 @@ func (c *Config) Validate() error {
 	if c.BatchInterval <= 0 {
 		return fmt.Errorf("BatchInterval must be positive")
 	}
-	if c.ClickHouse.Address == "" {
-		return fmt.Errorf("ClickHouse.Address must not be empty")
+	if len(c.ClickHouse.Addrs()) == 0 {
+		return fmt.Errorf("ClickHouse.Address or ClickHouse.Addresses must not be empty")
+	}
+	switch c.ClickHouse.ConnStrategy {
+	case "", "in_order", "round_robin", "random":
+	default:
+		return fmt.Errorf("ClickHouse.ConnStrategy must be in_order, round_robin or random")
+	}
+	cl := c.ClickHouse.Cluster
+	switch cl.Mode {
+	case "":
+	case "distributed", "shards":
+		if cl.Name == "" {
+			return fmt.Errorf("ClickHouse.Cluster.Name must not be empty for %s mode", cl.Mode)
+		}
+	default:
+		return fmt.Errorf("ClickHouse.Cluster.Mode must be distributed, shards or empty")
+	}
+	if cl.Mode == "shards" {
+		if len(cl.Shards) == 0 {
+			return fmt.Errorf("ClickHouse.Cluster.Shards must not be empty for shards mode")
+		}
+		for i, shard := range cl.Shards {
+			if len(shard) == 0 {
+				return fmt.Errorf("ClickHouse.Cluster.Shards[%d] must not be empty", i)
+			}
+		}
+		if len(cl.Weights) > 0 {
+			if len(cl.Weights) != len(cl.Shards) {
+				return fmt.Errorf("ClickHouse.Cluster.Weights must have one weight per shard")
+			}
+			total := 0
+			for _, w := range cl.Weights {
+				if w < 0 {
+					return fmt.Errorf("ClickHouse.Cluster.Weights must not be negative")
+				}
+				total += w
+			}
+			if total == 0 {
+				return fmt.Errorf("ClickHouse.Cluster.Weights must not all be zero")
+			}
+		}
+	}
+	switch cl.ShardingKey {
+	case "", "InfoBase", "User", "Session":
+	default:
+		return fmt.Errorf("ClickHouse.Cluster.ShardingKey must be InfoBase, User or Session")
 	}
 	if c.ClickHouse.Database == "" {
 		return fmt.Errorf("ClickHouse.Database must not be empty")
 	}
+	r := c.ClickHouse.Retry
+	if r.InitialIntervalMs < 0 || r.MaxInterval < 0 || r.Multiplier < 0 || r.MaxElapsed < 0 || r.BreakerThreshold < 0 || r.BreakerCooldown < 0 {
+		return fmt.Errorf("ClickHouse.Retry values must not be negative")
+	}
+	if (r.Jitter < 0 && r.Jitter != -1) || r.Jitter > 1 {
+		return fmt.Errorf("ClickHouse.Retry.Jitter must be -1 or between 0 and 1")
+	}
+	if c.Tail.MaxOpenFiles < -1 || c.Tail.IdleTimeout < -1 {
+		return fmt.Errorf("Tail.MaxOpenFiles and Tail.IdleTimeout must be -1 or greater")
+	}
+	if c.ProcessedGC.Interval < -1 || c.ProcessedGC.GracePeriod < 0 {
+		return fmt.Errorf("ProcessedGC.Interval must be -1 or greater, GracePeriod must not be negative")
+	}
+	if c.Spool.MaxSegmentSize < 0 || c.Spool.MaxSize < 0 {
+		return fmt.Errorf("Spool sizes must not be negative")
+	}
+	switch c.ProcessedStorage {
+	case "", "file", "redis", "bolt":
+	default:
+		return fmt.Errorf("ProcessedStorage must be file, redis or bolt")
+	}
+	switch c.Quarantine.Mode {
+	case "":
+	case "clickhouse":
+		if c.Quarantine.Table == "" {
+			return fmt.Errorf("Quarantine.Table must not be empty for clickhouse mode")
+		}
+	case "file":
+		if c.Quarantine.Path == "" {
+			return fmt.Errorf("Quarantine.Path must not be empty for file mode")
+		}
+	default:
+		return fmt.Errorf("Quarantine.Mode must be clickhouse, file or empty")
+	}
+	if _, err := c.ClickHouse.TLS.Build(); err != nil {
+		return fmt.Errorf("ClickHouse.TLS: %w", err)
+	}
+	if _, err := c.Redis.TLS.Build(); err != nil {
+		return fmt.Errorf("Redis.TLS: %w", err)
+	}
+	if c.TimeZone != "" {
+		if _, err := time.LoadLocation(c.TimeZone); err != nil {
+			return fmt.Errorf("TimeZone: %w", err)
+		}
+	}
+	if _, err := charset.Lookup(c.Encoding); err != nil {
+		return fmt.Errorf("Encoding: %w", err)
+	}
 	return nil
 }
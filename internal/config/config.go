@@ -6,24 +6,156 @@ import (
 
 // ClickHouseConfig содержит настройки подключения и маппинг таблиц по компонентам
 // Загружается из YAML
-// Поля обязательны: Address, Database
+// Поля обязательны: Address (или Addresses), Database
 // TableMap может быть пустым
 type ClickHouseConfig struct {
-	Address      string            `yaml:"Address"`
-	Username     string            `yaml:"Username"`
-	Password     string            `yaml:"Password"`
-	Database     string            `yaml:"Database"`
-	DefaultTable string            `yaml:"DefaultTable"`
-	Protocol     string            `yaml:"Protocol"`
-	TableMap     map[string]string `yaml:"TableMap"`
+	Address             string            `yaml:"Address"`
+	Addresses           []string          `yaml:"Addresses"`           // реплики host:port; Address, если задан, идёт первым
+	ConnStrategy        string            `yaml:"ConnStrategy"`        // выбор реплики: in_order (по умолчанию), round_robin, random
+	HealthCheckInterval int               `yaml:"HealthCheckInterval"` // проверка реплик, секунд; по умолчанию 15, -1 — не проверять
+	Cluster             ClusterConfig     `yaml:"Cluster"`
+	Username            string            `yaml:"Username"`
+	Password            string            `yaml:"Password"`
+	PasswordEnv         string            `yaml:"PasswordEnv"`  // переменная окружения с паролем
+	PasswordFile        string            `yaml:"PasswordFile"` // файл с паролем
+	TLS                 TLSConfig         `yaml:"TLS"`
+	Database            string            `yaml:"Database"`
+	DefaultTable        string            `yaml:"DefaultTable"`
+	Protocol            string            `yaml:"Protocol"`
+	TableMap            map[string]string `yaml:"TableMap"`
+	EventLogTable       string            `yaml:"EventLogTable"` // таблица журнала регистрации, обязательна при EventLogDirectoryMap
+	Schema              SchemaConfig      `yaml:"Schema"`
+	Retry               RetryConfig       `yaml:"Retry"`
+}
+
+// Addrs возвращает адреса реплик: Address и Addresses без повторов,
+// а для Cluster.Mode "shards" без явных адресов — реплики всех шардов
+func (c ClickHouseConfig) Addrs() []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	add := func(list ...string) {
+		for _, a := range list {
+			if a != "" && !seen[a] {
+				seen[a] = true
+				addrs = append(addrs, a)
+			}
+		}
+	}
+	add(c.Address)
+	add(c.Addresses...)
+	if len(addrs) == 0 && c.Cluster.Mode == "shards" {
+		for _, shard := range c.Cluster.Shards {
+			add(shard...)
+		}
+	}
+	return addrs
+}
+
+// ClusterConfig задаёт запись в кластер ClickHouse
+// Mode: "" — таблицы на узлах из Addresses (с Name DDL миграций выполняется ON CLUSTER);
+// "distributed" — вставка в Distributed-таблицы (имена из TableMap), они сами раскладывают строки по шардам;
+// "shards" — сервис сам раскладывает строки по шардам из Shards и пишет в локальные таблицы (имя + LocalSuffix)
+// В режимах distributed и shards миграции создают локальные таблицы и Distributed-таблицы над ними
+type ClusterConfig struct {
+	Name        string     `yaml:"Name"`        // имя кластера из remote_servers
+	Mode        string     `yaml:"Mode"`        // "", "distributed" или "shards"
+	ShardingKey string     `yaml:"ShardingKey"` // ключ шардирования: InfoBase (по умолчанию), User или Session
+	LocalSuffix string     `yaml:"LocalSuffix"` // суффикс локальных таблиц, по умолчанию _local
+	Shards      [][]string `yaml:"Shards"`      // реплики каждого шарда для Mode "shards"
+	Weights     []int      `yaml:"Weights"`     // веса шардов из remote_servers в том же порядке; пусто — по 1
+}
+
+// ShardWeight возвращает вес шарда i из Shards
+func (c ClusterConfig) ShardWeight(i int) uint64 {
+	if len(c.Weights) == 0 {
+		return 1
+	}
+	return uint64(c.Weights[i])
+}
+
+// LocalTable возвращает имя локальной таблицы шарда для таблицы table
+func (c ClusterConfig) LocalTable(table string) string {
+	if c.LocalSuffix == "" {
+		return table + "_local"
+	}
+	return table + c.LocalSuffix
+}
+
+// RetryConfig задаёт повтор вставок в ClickHouse при временных ошибках (сеть, перезапуск сервера)
+// Пауза растёт экспоненциально; после BreakerThreshold неудач подряд цепь размыкается
+// и вставка пробуется раз в BreakerCooldown секунд
+type RetryConfig struct {
+	InitialIntervalMs int     `yaml:"InitialIntervalMs"` // первая пауза, мс; по умолчанию 500
+	MaxInterval       int     `yaml:"MaxInterval"`       // предел паузы, секунд; по умолчанию 60
+	Multiplier        float64 `yaml:"Multiplier"`        // рост паузы; по умолчанию 2
+	Jitter            float64 `yaml:"Jitter"`            // случайный разброс паузы, доля от 0 до 1; по умолчанию 0.2, -1 — без разброса
+	MaxElapsed        int     `yaml:"MaxElapsed"`        // сколько секунд повторять один batch; 0 — без ограничения
+	BreakerThreshold  int     `yaml:"BreakerThreshold"`  // неудач подряд до размыкания; по умолчанию 5
+	BreakerCooldown   int     `yaml:"BreakerCooldown"`   // пауза перед пробной вставкой, секунд; по умолчанию 30
+}
+
+// SchemaConfig задаёт создание и обновление таблиц миграциями (при старте и командой migrate)
+// Параметры движка применяются только при создании таблицы
+type SchemaConfig struct {
+	Manual          bool   `yaml:"Manual"`          // не применять миграции при старте, только командой migrate
+	Engine          string `yaml:"Engine"`          // движок таблиц, по умолчанию MergeTree
+	PartitionBy     string `yaml:"PartitionBy"`     // PARTITION BY, по умолчанию EventDate (журнал регистрации — toYYYYMM(EventDate))
+	OrderBy         string `yaml:"OrderBy"`         // ORDER BY таблиц техжурнала, по умолчанию (EventDate, EventTime)
+	TTL             string `yaml:"TTL"`             // TTL, например "EventDate + INTERVAL 90 DAY"; пусто — без TTL
+	MigrationsTable string `yaml:"MigrationsTable"` // таблица применённых миграций, по умолчанию schema_migrations
 }
 
 // RedisConfig содержит настройки подключения к Redis
 type RedisConfig struct {
-	Host     string `yaml:"Host"`
-	Port     int    `yaml:"Port"`
-	DB       int    `yaml:"DB"`
-	Password string `yaml:"Password"`
+	Host         string    `yaml:"Host"`
+	Port         int       `yaml:"Port"`
+	DB           int       `yaml:"DB"`
+	KeyPrefix    string    `yaml:"KeyPrefix"` // префикс ключей, чтобы несколько экземпляров сервиса делили один Redis
+	Password     string    `yaml:"Password"`
+	PasswordEnv  string    `yaml:"PasswordEnv"`  // переменная окружения с паролем
+	PasswordFile string    `yaml:"PasswordFile"` // файл с паролем
+	TLS          TLSConfig `yaml:"TLS"`
+}
+
+// QuarantineConfig задаёт, куда складывать записи, которые не удалось разобрать
+// Mode: "clickhouse" — таблица Table, "file" — JSON Lines в Path, пусто — только предупреждение в лог
+type QuarantineConfig struct {
+	Mode  string `yaml:"Mode"`
+	Table string `yaml:"Table"`
+	Path  string `yaml:"Path"`
+}
+
+// ParserConfig задаёт формат логов каталога из LogDirectoryMap (ключ в Parsers — ключ LogDirectoryMap)
+// Type: "techlog" (по умолчанию), "jsonl" — JSON Lines, "regex" — строки по регулярному выражению
+type ParserConfig struct {
+	Type        string            `yaml:"Type"`
+	FilePattern string            `yaml:"FilePattern"` // шаблон имён файлов каталога (например, *.jsonl); пусто — общий FilePattern
+	Pattern     string            `yaml:"Pattern"`     // выражение с именованными группами (time, event, user…) для regex
+	Event       string            `yaml:"Event"`       // имя события для записей без поля event
+	TimeLayout  string            `yaml:"TimeLayout"`  // формат времени в нотации Go, "unix" или "unixms"; пусто — RFC3339
+	Fields      map[string]string `yaml:"Fields"`      // исходное имя поля -> стандартное имя
+}
+
+// SpoolConfig — дисковый буфер между чтением логов и ClickHouse: batch сохраняется
+// на диск до отправки и удаляется после подтверждения вставки
+type SpoolConfig struct {
+	Enabled        bool   `yaml:"Enabled"`
+	Dir            string `yaml:"Dir"`            // каталог сегментов, по умолчанию temp/spool
+	MaxSegmentSize int    `yaml:"MaxSegmentSize"` // размер сегмента, МБ; по умолчанию 64
+	MaxSize        int    `yaml:"MaxSize"`        // предел спула на диске, МБ; по умолчанию 1024
+}
+
+// TailConfig ограничивает число одновременно читаемых файлов: дочитанные и давно не менявшиеся
+// файлы закрываются и открываются снова с сохранённого смещения, когда в них появятся данные
+type TailConfig struct {
+	MaxOpenFiles int `yaml:"MaxOpenFiles"` // сколько файлов читается одновременно; по умолчанию 256, -1 — без ограничения
+	IdleTimeout  int `yaml:"IdleTimeout"`  // минут без изменений, после которых дочитанный файл закрывается; по умолчанию 10, -1 — не закрывать
+}
+
+// ProcessedGCConfig задаёт очистку состояния файлов, которые 1С удалила по истечении срока хранения логов
+type ProcessedGCConfig struct {
+	Interval    int `yaml:"Interval"`    // период очистки, минут; по умолчанию 60, -1 — не очищать
+	GracePeriod int `yaml:"GracePeriod"` // сколько часов хранить состояние удалённого файла; по умолчанию 24
 }
 
 // LoggingConfig содержит настройки логирования и интеграции с Sentry
@@ -47,15 +179,25 @@ type LoggingConfig struct {
 // Пример конфигурации см. README.md
 
 type Config struct {
-	LogDirectoryMap  map[string]string `yaml:"LogDirectoryMap"`
-	FilePattern      string            `yaml:"FilePattern"`
-	BatchSize        int               `yaml:"BatchSize"`
-	BatchInterval    int               `yaml:"BatchInterval"`
-	RescanInterval   int               `yaml:"RescanInterval"` // повторный обход директорий (секунд)
-	ClickHouse       ClickHouseConfig  `yaml:"ClickHouse"`
-	ProcessedStorage string            `yaml:"ProcessedStorage"` // "file" или "redis"
-	Redis            RedisConfig       `yaml:"Redis"`
-	Logging          LoggingConfig     `yaml:"Logging"`
+	LogDirectoryMap      map[string]string       `yaml:"LogDirectoryMap"`
+	EventLogDirectoryMap map[string]string       `yaml:"EventLogDirectoryMap"` // каталоги 1Cv8Log (1Cv8.lgf, *.lgp), ключ — имя ИБ
+	Parsers              map[string]ParserConfig `yaml:"Parsers"`              // формат логов по ключу LogDirectoryMap, по умолчанию техжурнал
+	FilePattern          string                  `yaml:"FilePattern"`
+	BatchSize            int                     `yaml:"BatchSize"`
+	BatchInterval        int                     `yaml:"BatchInterval"`
+	RescanInterval       int                     `yaml:"RescanInterval"`       // повторный обход директорий (секунд)
+	EventLogPollInterval int                     `yaml:"EventLogPollInterval"` // опрос 1Cv8.lgd (секунд), по умолчанию 10
+	TimeZone             string                  `yaml:"TimeZone"`             // часовой пояс серверов 1С, пусто — локальный
+	Encoding             string                  `yaml:"Encoding"`             // кодировка файлов без BOM: utf-8 (по умолчанию), windows-1251, utf-16le…
+	Tail                 TailConfig              `yaml:"Tail"`
+	ClickHouse           ClickHouseConfig        `yaml:"ClickHouse"`
+	ProcessedStorage     string                  `yaml:"ProcessedStorage"`     // "file", "redis" или "bolt" (встроенная база)
+	ProcessedStoragePath string                  `yaml:"ProcessedStoragePath"` // файл для file и bolt; по умолчанию temp/processed_files.json и temp/processed.db
+	Redis                RedisConfig             `yaml:"Redis"`
+	ProcessedGC          ProcessedGCConfig       `yaml:"ProcessedGC"`
+	Quarantine           QuarantineConfig        `yaml:"Quarantine"`
+	Spool                SpoolConfig             `yaml:"Spool"`
+	Logging              LoggingConfig           `yaml:"Logging"`
 }
 
 // LoadConfig читает и парсит конфиг из YAML-файла по указанному пути.
@@ -63,7 +205,8 @@ type Config struct {
 // 1. Чтение сырого файла
 // 2. Очистка данных: удаление BOM, замена табуляций
 // 3. Парсинг YAML в структуру Config
-// 4. Валидация обязательных полей
+// 4. Подстановка паролей из окружения и файлов
+// 5. Валидация обязательных полей
 func LoadConfig(path string) (*Config, error) {
 	// 1. Чтение
 	raw, err := readFile(path)
@@ -80,7 +223,12 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("unmarshal yaml: %w", err)
 	}
 
-	// 4. Валидация
+	// 4. Пароли
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("resolve secrets: %w", err)
+	}
+
+	// 5. Валидация
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("validate config: %w", err)
 	}
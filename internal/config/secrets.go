@@ -0,0 +1,87 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSConfig задаёт шифрование соединения с ClickHouse или Redis
+type TLSConfig struct {
+	Enabled            bool   `yaml:"Enabled"`
+	CAFile             string `yaml:"CAFile"`             // PEM-бандл корневых сертификатов; пусто — системные
+	CertFile           string `yaml:"CertFile"`           // клиентский сертификат (PEM) для взаимной аутентификации
+	KeyFile            string `yaml:"KeyFile"`            // ключ клиентского сертификата (PEM)
+	ServerName         string `yaml:"ServerName"`         // имя сервера для проверки сертификата, если отличается от адреса
+	InsecureSkipVerify bool   `yaml:"InsecureSkipVerify"` // не проверять сертификат сервера (только для отладки)
+}
+
+// Build собирает *tls.Config; nil — TLS выключен
+func (t TLSConfig) Build() (*tls.Config, error) {
+	if !t.Enabled {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file %s has no PEM certificates", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// resolveSecret возвращает пароль из переменной окружения env или файла file
+// (без завершающего перевода строки). Пароль прямо в YAML допускается, только если
+// ни env, ни file не заданы.
+func resolveSecret(inline, env, file string) (string, error) {
+	switch {
+	case env != "" && file != "":
+		return "", fmt.Errorf("PasswordEnv and PasswordFile are mutually exclusive")
+	case inline != "" && (env != "" || file != ""):
+		return "", fmt.Errorf("Password must be empty when PasswordEnv or PasswordFile is set")
+	case env != "":
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", env)
+		}
+		return v, nil
+	case file != "":
+		bs, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("read password file: %w", err)
+		}
+		return strings.TrimRight(string(bs), "\r\n"), nil
+	}
+	return inline, nil
+}
+
+// resolveSecrets подставляет пароли ClickHouse и Redis из окружения или файлов
+func (c *Config) resolveSecrets() error {
+	var err error
+	if c.ClickHouse.Password, err = resolveSecret(c.ClickHouse.Password, c.ClickHouse.PasswordEnv, c.ClickHouse.PasswordFile); err != nil {
+		return fmt.Errorf("ClickHouse: %w", err)
+	}
+	if c.Redis.Password, err = resolveSecret(c.Redis.Password, c.Redis.PasswordEnv, c.Redis.PasswordFile); err != nil {
+		return fmt.Errorf("Redis: %w", err)
+	}
+	return nil
+}
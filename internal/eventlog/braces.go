@@ -0,0 +1,191 @@
+package eventlog
+
+import (
+	"1CLogPumpClickHouse/internal/parser"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrBadRecord — запись журнала регистрации не соответствует скобочному формату
+var ErrBadRecord = errors.New("некорректная запись журнала регистрации")
+
+// Node — узел скобочного формата 1С: либо значение (Value), либо список ({...}) в Items
+type Node struct {
+	Value  string
+	Items  []Node
+	IsList bool
+	Quoted bool // значение было строкой в кавычках
+}
+
+// Item возвращает i-й элемент списка или пустой узел
+func (n Node) Item(i int) Node {
+	if i < 0 || i >= len(n.Items) {
+		return Node{}
+	}
+	return n.Items[i]
+}
+
+// String возвращает значение узла; для списка — исходное скобочное представление
+func (n Node) String() string {
+	if !n.IsList {
+		return n.Value
+	}
+	parts := make([]string, 0, len(n.Items))
+	for _, it := range n.Items {
+		if it.Quoted {
+			parts = append(parts, `"`+strings.ReplaceAll(it.Value, `"`, `""`)+`"`)
+		} else {
+			parts = append(parts, it.String())
+		}
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// ParseBraces разбирает запись вида {20230101123456,N,{2444a6a24da10,3d},1,"строка",...}.
+// Строки заключены в двойные кавычки, удвоенная кавычка внутри строки — сама кавычка.
+func ParseBraces(s string) (Node, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, ",")
+	n, pos, err := parseNode(s, 0)
+	if err != nil {
+		return Node{}, err
+	}
+	if !n.IsList {
+		return Node{}, fmt.Errorf("%w: ожидалась {", ErrBadRecord)
+	}
+	if rest := strings.TrimSpace(s[pos:]); rest != "" {
+		return Node{}, fmt.Errorf("%w: лишние символы после записи", ErrBadRecord)
+	}
+	return n, nil
+}
+
+func parseNode(s string, pos int) (Node, int, error) {
+	pos = skipSpaces(s, pos)
+	if pos >= len(s) {
+		return Node{}, pos, nil
+	}
+	switch s[pos] {
+	case '{':
+		n := Node{IsList: true}
+		pos++
+		for {
+			pos = skipSpaces(s, pos)
+			if pos >= len(s) {
+				return Node{}, pos, fmt.Errorf("%w: незакрытая {", ErrBadRecord)
+			}
+			if s[pos] == '}' {
+				return n, pos + 1, nil
+			}
+			item, next, err := parseNode(s, pos)
+			if err != nil {
+				return Node{}, next, err
+			}
+			n.Items = append(n.Items, item)
+			pos = skipSpaces(s, next)
+			if pos < len(s) && s[pos] == ',' {
+				pos++
+			}
+		}
+	case '"':
+		var b strings.Builder
+		for i := pos + 1; i < len(s); i++ {
+			if s[i] == '"' {
+				if i+1 < len(s) && s[i+1] == '"' {
+					b.WriteByte('"')
+					i++
+					continue
+				}
+				return Node{Value: b.String(), Quoted: true}, i + 1, nil
+			}
+			b.WriteByte(s[i])
+		}
+		return Node{}, len(s), fmt.Errorf("%w: незакрытая кавычка", ErrBadRecord)
+	default:
+		end := pos
+		for end < len(s) && s[end] != ',' && s[end] != '}' {
+			end++
+		}
+		return Node{Value: strings.TrimSpace(s[pos:end])}, end, nil
+	}
+}
+
+func skipSpaces(s string, pos int) int {
+	for pos < len(s) && (s[pos] == ' ' || s[pos] == '\t' || s[pos] == '\r' || s[pos] == '\n') {
+		pos++
+	}
+	return pos
+}
+
+// Assembler собирает строки файлов .lgp/.lgf в записи верхнего уровня {...}.
+// Заголовок файла ("1CV8LOG(ver 2.0)", идентификатор журнала) пропускается.
+// Запись завершена, когда строка заканчивается на нулевой глубине скобок вне кавычек.
+type Assembler struct {
+	Offset int64 // Смещение в файле, с которого читается следующая строка
+
+	buf     strings.Builder
+	start   int64
+	depth   int
+	inQuote bool
+}
+
+// Push добавляет строку и возвращает завершённые записи.
+// size — сколько байт строка занимала в файле вместе с переводом строки.
+func (a *Assembler) Push(line string, size int64) []parser.Record {
+	defer func() { a.Offset += size }()
+	line = strings.TrimSuffix(line, "\r")
+	if a.buf.Len() == 0 {
+		trimmed := strings.TrimPrefix(strings.TrimSpace(line), "\uFEFF")
+		if !strings.HasPrefix(trimmed, "{") {
+			return nil
+		}
+		a.start = a.Offset
+	} else {
+		a.buf.WriteByte('\n')
+	}
+	a.buf.WriteString(line)
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case a.inQuote:
+			if c == '"' {
+				if i+1 < len(line) && line[i+1] == '"' {
+					i++
+					continue
+				}
+				a.inQuote = false
+			}
+		case c == '"':
+			a.inQuote = true
+		case c == '{':
+			a.depth++
+		case c == '}':
+			a.depth--
+		}
+	}
+	if a.depth > 0 || a.inQuote {
+		return nil
+	}
+	rec := parser.Record{Text: a.buf.String(), Offset: a.start, End: a.Offset + size}
+	a.buf.Reset()
+	a.depth = 0
+	return []parser.Record{rec}
+}
+
+// Flush возвращает недособранную запись, если она есть
+func (a *Assembler) Flush() (parser.Record, bool) {
+	if a.buf.Len() == 0 {
+		return parser.Record{}, false
+	}
+	rec := parser.Record{Text: a.buf.String(), Offset: a.start, End: a.Offset}
+	a.buf.Reset()
+	a.depth = 0
+	a.inQuote = false
+	return rec, true
+}
+
+// Pending сообщает, есть ли недособранная запись
+func (a *Assembler) Pending() bool {
+	return a.buf.Len() > 0
+}
@@ -0,0 +1,116 @@
+package eventlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Виды элементов словаря 1Cv8.lgf (первое поле записи)
+const (
+	KindUser        = 1
+	KindComputer    = 2
+	KindApplication = 3
+	KindEvent       = 4
+	KindMetadata    = 5
+	KindServer      = 6
+	KindMainPort    = 7
+	KindSecondPort  = 8
+)
+
+// DictItem — элемент словаря: имя и, для пользователей и метаданных, идентификатор
+type DictItem struct {
+	Name string
+	UUID string
+}
+
+// Dictionary — словарь журнала регистрации из 1Cv8.lgf.
+// Файл только дописывается, поэтому Load дочитывает его с последней разобранной записи.
+type Dictionary struct {
+	path   string
+	mu     sync.RWMutex
+	items  map[int]map[int64]DictItem
+	offset int64
+}
+
+func NewDictionary(path string) *Dictionary {
+	return &Dictionary{path: path, items: make(map[int]map[int64]DictItem)}
+}
+
+// Load дочитывает новые записи словаря
+func (d *Dictionary) Load() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f, err := os.Open(d.path)
+	if err != nil {
+		return fmt.Errorf("open dictionary: %w", err)
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Size() < d.offset {
+		// файл пересоздан (например, после сокращения журнала) — читаем заново
+		d.offset = 0
+		d.items = make(map[int]map[int64]DictItem)
+	}
+	if _, err := f.Seek(d.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek dictionary: %w", err)
+	}
+
+	a := Assembler{Offset: d.offset}
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			// неполную последнюю строку дочитаем в следующий раз
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read dictionary: %w", err)
+		}
+		for _, rec := range a.Push(strings.TrimSuffix(line, "\n"), int64(len(line))) {
+			d.offset = rec.End
+			n, err := ParseBraces(rec.Text)
+			if err != nil {
+				continue
+			}
+			d.add(n)
+		}
+	}
+	return nil
+}
+
+// add добавляет запись вида {вид,[uuid,]"имя",код}
+func (d *Dictionary) add(n Node) {
+	if len(n.Items) < 3 {
+		return
+	}
+	kind, err := strconv.Atoi(n.Item(0).Value)
+	if err != nil {
+		return
+	}
+	last := len(n.Items) - 1
+	code, err := strconv.ParseInt(n.Item(last).Value, 10, 64)
+	if err != nil {
+		return
+	}
+	item := DictItem{Name: n.Item(last - 1).String()}
+	if last >= 3 {
+		item.UUID = n.Item(1).String()
+	}
+	if d.items[kind] == nil {
+		d.items[kind] = make(map[int64]DictItem)
+	}
+	d.items[kind][code] = item
+}
+
+// Lookup возвращает элемент словаря по виду и коду
+func (d *Dictionary) Lookup(kind int, code int64) (DictItem, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	item, ok := d.items[kind][code]
+	return item, ok
+}
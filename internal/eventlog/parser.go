@@ -0,0 +1,24 @@
+package eventlog
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"1CLogPumpClickHouse/internal/parser"
+	"time"
+)
+
+// Parser — журнал регистрации в формате .lgp, коды раскрываются по словарю каталога
+type Parser struct {
+	InfoBase string         // имя информационной базы (ключ EventLogDirectoryMap)
+	Dict     *Dictionary    // словарь 1Cv8.lgf каталога журнала
+	Location *time.Location // часовой пояс серверов 1С
+}
+
+func (p *Parser) NewAssembler(offset int64) parser.Assembler {
+	return &Assembler{Offset: offset}
+}
+
+func (p *Parser) Parse(record parser.Record) (models.LogEntry, error) {
+	rec, err := Decode(record.Text, p.Dict, p.Location)
+	rec.InfoBase = p.InfoBase
+	return models.LogEntry{EventTime: rec.EventTime, EventLog: &rec}, err
+}
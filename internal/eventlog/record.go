@@ -0,0 +1,139 @@
+package eventlog
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Статусы транзакции и уровни важности в представлении журнала регистрации
+var (
+	transactionStatuses = map[string]string{
+		"N": "Нет транзакции",
+		"U": "Зафиксирована",
+		"R": "Не завершена",
+		"C": "Отменена",
+	}
+	severities = map[string]string{
+		"I": "Информация",
+		"E": "Ошибка",
+		"W": "Предупреждение",
+		"N": "Примечание",
+	}
+)
+
+// секунд от 0001-01-01 до 1970-01-01: время транзакции хранится в 1/10000 с от начала эпохи 1С
+const epoch1CSeconds = 62135596800
+
+// Decode разбирает запись .lgp и разрешает коды через словарь.
+// Если кода нет в словаре, словарь дочитывается один раз (он мог быть дописан после записи).
+// loc — часовой пояс сервера 1С: даты в журнале записаны в его локальном времени.
+func Decode(text string, dict *Dictionary, loc *time.Location) (models.EventLogRecord, error) {
+	n, err := ParseBraces(text)
+	if err != nil {
+		return models.EventLogRecord{}, err
+	}
+	if len(n.Items) < 17 {
+		return models.EventLogRecord{}, fmt.Errorf("%w: %d полей вместо 18", ErrBadRecord, len(n.Items))
+	}
+
+	eventTime, err := time.ParseInLocation("20060102150405", n.Item(0).Value, loc)
+	if err != nil {
+		return models.EventLogRecord{}, fmt.Errorf("%w: дата %q", ErrBadRecord, n.Item(0).Value)
+	}
+
+	reloaded := false
+	lookup := func(kind int, field Node) DictItem {
+		code, err := strconv.ParseInt(field.Value, 10, 64)
+		if err != nil || code == 0 {
+			// 0 — значение не задано (например, событие без метаданных)
+			return DictItem{}
+		}
+		item, ok := dict.Lookup(kind, code)
+		if !ok && !reloaded {
+			reloaded = true
+			if dict.Load() == nil {
+				item, _ = dict.Lookup(kind, code)
+			}
+		}
+		return item
+	}
+
+	user := lookup(KindUser, n.Item(3))
+	metadata := lookup(KindMetadata, n.Item(10))
+	tx := n.Item(2)
+	rec := models.EventLogRecord{
+		EventTime:         eventTime,
+		TransactionStatus: statusName(transactionStatuses, n.Item(1).Value),
+		TransactionTime:   transactionTime(tx.Item(0).Value, loc),
+		TransactionNumber: parseHex(tx.Item(1).Value),
+		User:              user.Name,
+		UserUUID:          user.UUID,
+		Computer:          lookup(KindComputer, n.Item(4)).Name,
+		Application:       lookup(KindApplication, n.Item(5)).Name,
+		Connection:        parseUint(n.Item(6).Value),
+		Event:             lookup(KindEvent, n.Item(7)).Name,
+		Severity:          statusName(severities, n.Item(8).Value),
+		Comment:           n.Item(9).Value,
+		Metadata:          metadata.Name,
+		MetadataUUID:      metadata.UUID,
+		Data:              dataString(n.Item(11)),
+		DataPresentation:  n.Item(12).Value,
+		Server:            lookup(KindServer, n.Item(13)).Name,
+		MainPort:          uint32(parseUint(lookup(KindMainPort, n.Item(14)).Name)),
+		SecondPort:        uint32(parseUint(lookup(KindSecondPort, n.Item(15)).Name)),
+		Session:           parseUint(n.Item(16).Value),
+	}
+	return rec, nil
+}
+
+func statusName(names map[string]string, code string) string {
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return code
+}
+
+// transactionTime переводит время транзакции (hex, 1/10000 с от 0001-01-01) в time.Time
+func transactionTime(hex string, loc *time.Location) time.Time {
+	return ticksToTime(parseHex(hex), loc)
+}
+
+// ticksToTime переводит время 1С (1/10000 с от 0001-01-01) в time.Time
+func ticksToTime(ticks uint64, loc *time.Location) time.Time {
+	if ticks == 0 {
+		return time.Time{}
+	}
+	secs := int64(ticks/10000) - epoch1CSeconds
+	nsec := int64(ticks%10000) * 100000
+	utc := time.Unix(secs, nsec).UTC()
+	// значение — локальное время сервера, записанное без часового пояса
+	return time.Date(utc.Year(), utc.Month(), utc.Day(), utc.Hour(), utc.Minute(), utc.Second(), utc.Nanosecond(), loc)
+}
+
+// dataString приводит поле данных к строке: {"S","текст"} → текст, {"U"} → пусто,
+// остальные типы остаются в скобочном представлении
+func dataString(n Node) string {
+	if !n.IsList {
+		return n.Value
+	}
+	switch n.Item(0).Value {
+	case "U":
+		return ""
+	case "S", "N", "B", "D":
+		return n.Item(1).String()
+	}
+	return n.String()
+}
+
+func parseHex(s string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimSpace(s), 16, 64)
+	return n
+}
+
+func parseUint(s string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	return n
+}
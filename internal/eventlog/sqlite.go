@@ -0,0 +1,115 @@
+package eventlog
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Статусы транзакции и уровни важности в формате SQLite (1Cv8.lgd) хранятся числами
+var (
+	lgdTransactionStatuses = map[int64]string{
+		0: "Зафиксирована",
+		1: "Нет транзакции",
+		2: "Не завершена",
+		3: "Отменена",
+	}
+	lgdSeverities = map[int64]string{
+		0: "Информация",
+		1: "Предупреждение",
+		2: "Ошибка",
+		3: "Примечание",
+	}
+)
+
+// lgdQuery выбирает записи EventLog после заданного rowID с разрешёнными через таблицы-словари кодами
+const lgdQuery = `
+SELECT el.rowID, el.severity, el.date, el.connectID, el.session,
+       el.transactionStatus, el.transactionDate, el.transactionID,
+       IFNULL(uc.name, ''), IFNULL(uc.uuid, ''), IFNULL(cc.name, ''), IFNULL(ac.name, ''), IFNULL(ec.name, ''),
+       IFNULL(el.comment, ''), IFNULL(mc.name, ''), IFNULL(mc.uuid, ''),
+       IFNULL(el.data, ''), IFNULL(el.dataPresentation, ''),
+       IFNULL(ws.name, ''), IFNULL(pp.name, 0), IFNULL(sp.name, 0)
+FROM EventLog el
+LEFT JOIN UserCodes uc ON uc.code = el.userCode
+LEFT JOIN ComputerCodes cc ON cc.code = el.computerCode
+LEFT JOIN AppCodes ac ON ac.code = el.appCode
+LEFT JOIN EventCodes ec ON ec.code = el.eventCode
+LEFT JOIN MetadataCodes mc ON mc.code = el.metadataCodes
+LEFT JOIN WorkServerCodes ws ON ws.code = el.workServerCode
+LEFT JOIN PrimaryPortCodes pp ON pp.code = el.primaryPortCode
+LEFT JOIN SecondaryPortCodes sp ON sp.code = el.secondaryPortCode
+WHERE el.rowID > ?
+ORDER BY el.rowID
+LIMIT ?`
+
+// SQLiteReader читает журнал регистрации в формате SQLite (1Cv8.lgd).
+// База открывается только на чтение: 1С продолжает писать в неё параллельно.
+type SQLiteReader struct {
+	db  *sql.DB
+	loc *time.Location
+}
+
+// OpenSQLite открывает 1Cv8.lgd; loc — часовой пояс сервера 1С
+func OpenSQLite(path string, loc *time.Location) (*SQLiteReader, error) {
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?mode=ro&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open lgd: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	return &SQLiteReader{db: db, loc: loc}, nil
+}
+
+// ReadAfter возвращает не более limit записей с rowID больше afterRowID
+// вместе с их rowID (в порядке возрастания)
+func (r *SQLiteReader) ReadAfter(ctx context.Context, afterRowID int64, limit int) ([]models.EventLogRecord, []int64, error) {
+	rows, err := r.db.QueryContext(ctx, lgdQuery, afterRowID, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query lgd: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		records []models.EventLogRecord
+		rowIDs  []int64
+	)
+	for rows.Next() {
+		var (
+			rowID, severity, date, connectID, session int64
+			txStatus, txDate, txID                    int64
+			rec                                       models.EventLogRecord
+		)
+		if err := rows.Scan(&rowID, &severity, &date, &connectID, &session,
+			&txStatus, &txDate, &txID,
+			&rec.User, &rec.UserUUID, &rec.Computer, &rec.Application, &rec.Event,
+			&rec.Comment, &rec.Metadata, &rec.MetadataUUID,
+			&rec.Data, &rec.DataPresentation,
+			&rec.Server, &rec.MainPort, &rec.SecondPort); err != nil {
+			return nil, nil, fmt.Errorf("scan lgd: %w", err)
+		}
+		rec.EventTime = ticksToTime(uint64(date), r.loc)
+		rec.TransactionStatus = lgdTransactionStatuses[txStatus]
+		rec.TransactionTime = ticksToTime(uint64(txDate), r.loc)
+		rec.TransactionNumber = uint64(txID)
+		rec.Severity = lgdSeverities[severity]
+		rec.Connection = uint64(connectID)
+		rec.Session = uint64(session)
+		records = append(records, rec)
+		rowIDs = append(rowIDs, rowID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("read lgd: %w", err)
+	}
+	return records, rowIDs, nil
+}
+
+// Close закрывает базу
+func (r *SQLiteReader) Close() error {
+	return r.db.Close()
+}
@@ -0,0 +1,140 @@
+package eventlog
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// lgdSchema — таблицы 1Cv8.lgd, которые читает lgdQuery
+const lgdSchema = `
+CREATE TABLE EventLog (rowID INTEGER PRIMARY KEY, severity INTEGER, date INTEGER, connectID INTEGER, session INTEGER,
+	transactionStatus INTEGER, transactionDate INTEGER, transactionID INTEGER,
+	userCode INTEGER, computerCode INTEGER, appCode INTEGER, eventCode INTEGER, comment TEXT,
+	metadataCodes INTEGER, sessionDataSplitCode INTEGER, dataType INTEGER, data TEXT, dataPresentation TEXT,
+	workServerCode INTEGER, primaryPortCode INTEGER, secondaryPortCode INTEGER);
+CREATE TABLE UserCodes (code INTEGER PRIMARY KEY, uuid TEXT, name TEXT);
+CREATE TABLE ComputerCodes (code INTEGER PRIMARY KEY, name TEXT);
+CREATE TABLE AppCodes (code INTEGER PRIMARY KEY, name TEXT);
+CREATE TABLE EventCodes (code INTEGER PRIMARY KEY, name TEXT);
+CREATE TABLE MetadataCodes (code INTEGER PRIMARY KEY, uuid TEXT, name TEXT);
+CREATE TABLE WorkServerCodes (code INTEGER PRIMARY KEY, name TEXT);
+CREATE TABLE PrimaryPortCodes (code INTEGER PRIMARY KEY, name INTEGER);
+CREATE TABLE SecondaryPortCodes (code INTEGER PRIMARY KEY, name INTEGER);
+INSERT INTO UserCodes VALUES (1, 'a1b2c3d4-0000-0000-0000-000000000001', 'Иванов');
+INSERT INTO ComputerCodes VALUES (1, 'SRV1C');
+INSERT INTO AppCodes VALUES (1, '1CV8C');
+INSERT INTO EventCodes VALUES (1, '_$Data$_.Update'), (2, '_$Session$_.Start');
+INSERT INTO MetadataCodes VALUES (1, 'f0e1d2c3-0000-0000-0000-000000000002', 'Документ.РеализацияТоваровУслуг');
+INSERT INTO WorkServerCodes VALUES (1, 'srv1c');
+INSERT INTO PrimaryPortCodes VALUES (1, 1541);
+INSERT INTO SecondaryPortCodes VALUES (1, 1560);
+`
+
+// lgdTicks переводит время в тики 1С (десятитысячные доли секунды от 0001-01-01)
+func lgdTicks(t time.Time) int64 {
+	return (t.Unix() + epoch1CSeconds) * 10000
+}
+
+// writeLgd создаёт 1Cv8.lgd во временном каталоге: событие изменения данных
+// в транзакции и n событий начала сеанса без кодов пользователя и метаданных
+func writeLgd(t *testing.T, eventTime time.Time, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "1Cv8.lgd")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(lgdSchema); err != nil {
+		t.Fatal(err)
+	}
+	ticks := lgdTicks(eventTime)
+	if _, err := db.Exec(`INSERT INTO EventLog VALUES (10, 0, ?, 7, 42, 0, ?, 1234, 1, 1, 1, 1, 'комментарий',
+		1, 0, 0, 'данные', 'Реализация № 1', 1, 1, 1)`, ticks, ticks); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if _, err := db.Exec(`INSERT INTO EventLog (rowID, severity, date, connectID, session, transactionStatus,
+			transactionDate, transactionID, eventCode) VALUES (?, 2, ?, 8, 43, 1, 0, 0, 2)`, 11+i, ticks); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestSQLiteReaderReadAfter(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	eventTime := time.Date(2025, 5, 26, 7, 15, 30, 0, time.UTC)
+	r, err := OpenSQLite(writeLgd(t, eventTime, 4), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	ctx := context.Background()
+
+	records, rowIDs, err := r.ReadAfter(ctx, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || rowIDs[0] != 10 || rowIDs[1] != 11 {
+		t.Fatalf("первая страница: rowIDs %v", rowIDs)
+	}
+	got := records[0]
+	want := time.Date(2025, 5, 26, 7, 15, 30, 0, loc)
+	if !got.EventTime.Equal(want) || !got.TransactionTime.Equal(want) {
+		t.Errorf("EventTime = %v, TransactionTime = %v, want %v", got.EventTime, got.TransactionTime, want)
+	}
+	checks := []struct{ name, got, want string }{
+		{"User", got.User, "Иванов"},
+		{"UserUUID", got.UserUUID, "a1b2c3d4-0000-0000-0000-000000000001"},
+		{"Computer", got.Computer, "SRV1C"},
+		{"Application", got.Application, "1CV8C"},
+		{"Event", got.Event, "_$Data$_.Update"},
+		{"Comment", got.Comment, "комментарий"},
+		{"Metadata", got.Metadata, "Документ.РеализацияТоваровУслуг"},
+		{"MetadataUUID", got.MetadataUUID, "f0e1d2c3-0000-0000-0000-000000000002"},
+		{"Data", got.Data, "данные"},
+		{"DataPresentation", got.DataPresentation, "Реализация № 1"},
+		{"Server", got.Server, "srv1c"},
+		{"TransactionStatus", got.TransactionStatus, "Зафиксирована"},
+		{"Severity", got.Severity, "Информация"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %q, want %q", c.name, c.got, c.want)
+		}
+	}
+	if got.MainPort != 1541 || got.SecondPort != 1560 || got.Connection != 7 || got.Session != 42 || got.TransactionNumber != 1234 {
+		t.Errorf("числовые поля: %+v", got)
+	}
+
+	// событие без кодов словарей: пустые строки вместо NULL
+	empty := records[1]
+	if empty.User != "" || empty.Metadata != "" || empty.Severity != "Ошибка" || empty.TransactionStatus != "Нет транзакции" ||
+		!empty.TransactionTime.IsZero() {
+		t.Errorf("событие без словарей: %+v", empty)
+	}
+
+	// следующие страницы — строго после последнего прочитанного rowID
+	records, rowIDs, err = r.ReadAfter(ctx, rowIDs[len(rowIDs)-1], 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || rowIDs[0] != 12 || rowIDs[1] != 13 {
+		t.Fatalf("вторая страница: rowIDs %v", rowIDs)
+	}
+	records, rowIDs, err = r.ReadAfter(ctx, 13, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || rowIDs[0] != 14 {
+		t.Fatalf("последняя страница: rowIDs %v", rowIDs)
+	}
+	records, _, err = r.ReadAfter(ctx, 14, 2)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("после конца журнала: %d записей, %v", len(records), err)
+	}
+}
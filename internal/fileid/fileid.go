@@ -0,0 +1,38 @@
+package fileid
+
+import (
+	"hash/fnv"
+	"io"
+	"os"
+)
+
+// FingerprintSize — сколько первых байт файла входит в отпечаток
+const FingerprintSize = 1024
+
+// Identity — идентичность файла в файловой системе: устройство и inode
+// (на Windows — серийный номер тома и индекс файла). Нулевая — определить не удалось.
+type Identity struct {
+	Dev   uint64
+	Inode uint64
+}
+
+// Known сообщает, что идентичность определена
+func (id Identity) Known() bool {
+	return id.Inode != 0
+}
+
+// Fingerprint возвращает хеш первых n байт файла (не больше FingerprintSize) и их фактическое число:
+// у короткого файла отпечаток строится по тому, что уже записано
+func Fingerprint(f *os.File, n int) (uint64, int, error) {
+	if n > FingerprintSize {
+		n = FingerprintSize
+	}
+	buf := make([]byte, n)
+	read, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return 0, 0, err
+	}
+	h := fnv.New64a()
+	h.Write(buf[:read])
+	return h.Sum64(), read, nil
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package fileid
+
+import (
+	"os"
+	"syscall"
+)
+
+// Of возвращает идентичность открытого файла
+func Of(f *os.File) (Identity, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return Identity{}, err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return Identity{}, nil
+	}
+	return Identity{Dev: uint64(st.Dev), Inode: uint64(st.Ino)}, nil
+}
@@ -0,0 +1,18 @@
+package fileid
+
+import (
+	"os"
+	"syscall"
+)
+
+// Of возвращает идентичность открытого файла: серийный номер тома и индекс файла
+func Of(f *os.File) (Identity, error) {
+	var info syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(syscall.Handle(f.Fd()), &info); err != nil {
+		return Identity{}, err
+	}
+	return Identity{
+		Dev:   uint64(info.VolumeSerialNumber),
+		Inode: uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow),
+	}, nil
+}
@@ -6,11 +6,12 @@ import "time"
 // Timestamp = имя файла-лога
 // LogTimestamp = исходное время события внутри лога (если требуется)
 type LogEntry struct {
-	Timestamp       string // Имя файла (например: "25052607.log")
-	LogTimestamp    string // Время события из первой строки лога, если нужно (например: "00:03.310025-1327862")
-	Component       string
-	Severity        uint8
-	Level           string
+	Timestamp       string    // Имя файла (например: "25052607.log")
+	LogTimestamp    string    // Время события внутри часа из шапки записи (например: "00:03.310025")
+	EventTime       time.Time // Полное время события с точностью до микросекунды (см. transform.TimeResolver)
+	Duration        uint64    // Длительность события в микросекундах
+	EventName       string    // Имя события: DBMSSQL, TLOCK, CALL, ...
+	Depth           uint8     // Уровень вложенности события
 	Process         string
 	ProcessName     string
 	OSThread        uint32
@@ -25,31 +26,150 @@ type LogEntry struct {
 	Trans           uint32
 	DBPID           uint32
 	SQL             string
+	SQLNormalized   string // Шаблон запроса без литералов и параметров
+	SQLHash         uint64 // Отпечаток SQLNormalized для группировки
 	Rows            int32
 	RowsAffected    int32
 	Context         string
-	EventType       string
-	File            string
+	ContextFrames   []ContextFrame    // Context, разложенный на кадры стека
+	File            string            // Полный путь к файлу лога
+	Offset          int64             // Смещение записи в файле
+	End             int64             // Смещение сразу после записи (для 1Cv8.lgd — rowID): до него файл обработан
+	Gen             uint64            // Поколение чтения файла: меняется, когда по пути оказывается другой файл или он усечён
+	Raw             string            // Исходный текст записи
+	ParseError      string            // Причина ошибки разбора; такие записи уходят в карантин
+	Properties      map[string]string // Все свойства записи, не разобранные в отдельные поля
 	InsertedAt      time.Time
+
+	// Типизированные данные по виду события; заполняется только соответствующее событию поле
+	Lock      *LockEvent      // TLOCK, TTIMEOUT
+	Deadlock  *DeadlockEvent  // TDEADLOCK
+	Call      *CallEvent      // CALL, SCALL
+	Exception *ExceptionEvent // EXCP
+	Plan      *SQLPlan        // DBMSSQL, DBPOSTGRS с planSQLText
+
+	EventLog *EventLogRecord // Запись журнала регистрации (.lgp) вместо записи техжурнала
+}
+
+// FileGen — файл и поколение его чтения (LogEntry.File, LogEntry.Gen): смещения фиксируются
+// только для текущего поколения, смещения заменённого или усечённого файла отбрасываются
+type FileGen struct {
+	File string
+	Gen  uint64
+}
+
+// EventLogRecord — запись журнала регистрации с разрешёнными через словарь 1Cv8.lgf кодами
+type EventLogRecord struct {
+	InfoBase          string // Ключ каталога из EventLogDirectoryMap
+	EventTime         time.Time
+	TransactionStatus string
+	TransactionTime   time.Time
+	TransactionNumber uint64
+	User              string
+	UserUUID          string
+	Computer          string
+	Application       string
+	Connection        uint64
+	Event             string
+	Severity          string
+	Comment           string
+	Metadata          string
+	MetadataUUID      string
+	Data              string
+	DataPresentation  string
+	Server            string
+	MainPort          uint32
+	SecondPort        uint32
+	Session           uint64
+}
+
+// SQLPlan — план запроса из свойства planSQLText
+type SQLPlan struct {
+	Text          string  // Текст плана целиком
+	Scans         uint32  // Количество операторов сканирования (Table/Index Scan, Seq Scan)
+	Seeks         uint32  // Количество операторов поиска по индексу
+	EstimatedRows float64 // Оценка количества строк корневого оператора
+}
+
+// ContextFrame — кадр стека встроенного языка из свойства Context
+type ContextFrame struct {
+	Module string // Путь модуля: "ОбщийМодуль.ОбщегоНазначения.Модуль"
+	Line   uint32 // Номер строки модуля, 0 — если не указан
+	Code   string // Текст строки кода
+}
+
+// LockEvent — управляемые блокировки (TLOCK, TTIMEOUT)
+type LockEvent struct {
+	Regions         []string // Пространства блокировок
+	Locks           string   // Список блокировок с режимами и значениями полей
+	WaitConnections []uint32 // Соединения, которых ожидали
+}
+
+// DeadlockEvent — взаимоблокировка (TDEADLOCK)
+type DeadlockEvent struct {
+	Victim        uint32   // Соединение, на котором возникла взаимоблокировка
+	Participants  []uint32 // Все соединения из DeadlockConnectionIntersections
+	Intersections string   // Исходное значение DeadlockConnectionIntersections
+}
+
+// CallEvent — серверный вызов (CALL, SCALL)
+type CallEvent struct {
+	Interface  string
+	Method     string
+	CpuTime    uint64 // мкс
+	Memory     int64  // байт
+	MemoryPeak int64  // байт
+	InBytes    uint64
+	OutBytes   uint64
+}
+
+// ExceptionEvent — исключение (EXCP)
+type ExceptionEvent struct {
+	Exception string // Класс исключения
+	Descr     string // Описание ошибки
 }
 
 // LogEntryFull — алиас для совместимости с clickhouseclient (используй LogEntry как основную модель)
 type LogEntryFull = LogEntry
 type TechLogRow struct {
-	EventDate     string
-	EventTime     string
-	EventType     string
-	Duration      uint32
-	User          string
-	InfoBase      string
-	SessionID     uint32
-	ClientID      uint32
-	ConnectionID  uint32
-	ExceptionType *string
-	ErrorText     *string
-	SQLText       *string
-	Rows          *int32
-	RowsAffected  *int32
-	Context       *string
-	ProcessName   string
+	EventDate        time.Time
+	EventTime        time.Time
+	EventType        string
+	Duration         uint64
+	User             string
+	InfoBase         string
+	SessionID        uint64
+	ClientID         uint32
+	ConnectionID     uint32
+	ExceptionType    *string
+	ErrorText        *string
+	SQLText          *string
+	SQLNormalized    string
+	SQLHash          uint64
+	Rows             *int32
+	RowsAffected     *int32
+	Context          *string
+	ContextFirstLine string
+	ContextLastLine  string
+	ContextFrames    []string
+	ProcessName      string
+	Properties       map[string]string
+
+	LockRegions           []string
+	Locks                 string
+	WaitConnections       []uint32
+	DeadlockVictim        uint32
+	DeadlockParticipants  []uint32
+	DeadlockIntersections string
+	CallInterface         string
+	CallMethod            string
+	CpuTime               uint64
+	Memory                int64
+	MemoryPeak            int64
+	InBytes               uint64
+	OutBytes              uint64
+	PlanSQLText           string
+	PlanScans             uint32
+	PlanSeeks             uint32
+	PlanEstimatedRows     float64
 }
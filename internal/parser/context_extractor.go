@@ -1,17 +1,46 @@
 package parser
 
-import "strings"
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"strconv"
+	"strings"
+)
 
-// extractContext — ищет ,Context='...' и достаёт многострочный Context
+// extractContext — приводит значение свойства Context к виду без обрамляющих пробелов.
+// Многострочный Context уже собран токенизатором целиком, вместе с переводами строк.
 func extractContext(s string) string {
-	idx := strings.Index(s, ",Context='")
-	if idx == -1 {
-		return ""
-	}
-	ctx := s[idx+len(",Context='"):]
-	end := strings.LastIndex(ctx, "'") // Исправлено: только одиночная кавычка
-	if end == -1 {
-		return ctx
+	return strings.TrimSpace(s)
+}
+
+// ParseContext раскладывает Context на кадры стека, по одному на строку:
+// "ОбщийМодуль.ОбщегоНазначения.Модуль : 123 : Результат = Запрос.Выполнить();".
+// Первая строка контекста клиентского вызова имеет вид "Форма.Вызов : Модуль.Процедура"
+// и номера строки не содержит.
+func ParseContext(ctx string) []models.ContextFrame {
+	var frames []models.ContextFrame
+	for _, line := range strings.Split(ctx, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, " : ", 3)
+		frame := models.ContextFrame{Module: strings.TrimSpace(parts[0])}
+		switch len(parts) {
+		case 3:
+			if n, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 32); err == nil {
+				frame.Line = uint32(n)
+				frame.Code = strings.TrimSpace(parts[2])
+			} else {
+				frame.Code = strings.TrimSpace(parts[1] + " : " + parts[2])
+			}
+		case 2:
+			if n, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 32); err == nil {
+				frame.Line = uint32(n)
+			} else {
+				frame.Code = strings.TrimSpace(parts[1])
+			}
+		}
+		frames = append(frames, frame)
 	}
-	return ctx[:end]
+	return frames
 }
@@ -0,0 +1,12 @@
+package parser
+
+import "errors"
+
+// Ошибки разбора записей. Парсеры оборачивают их через %w,
+// причину можно проверить через errors.Is.
+var (
+	ErrUnterminatedQuote = errors.New("незакрытая кавычка в значении свойства")
+	ErrBadHeader         = errors.New("некорректная шапка записи")
+	ErrBadTime           = errors.New("некорректное время записи")
+	ErrBadRecord         = errors.New("запись не соответствует формату")
+)
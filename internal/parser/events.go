@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"strings"
+)
+
+// EventDecoder — декодер свойств конкретного типа события техжурнала.
+// Keys — свойства, которые декодер забирает себе (они не попадают в LogEntry.Properties).
+// Decode — заполняет типизированную часть LogEntry по шапке записи.
+type EventDecoder struct {
+	Keys   []string
+	Decode func(entry *models.LogEntry, header map[string]string)
+}
+
+// decoders — реестр декодеров по имени события (TLOCK, CALL, ...)
+var decoders = make(map[string]EventDecoder)
+
+// RegisterDecoder регистрирует декодер для события, заменяя ранее зарегистрированный.
+func RegisterDecoder(event string, d EventDecoder) {
+	decoders[event] = d
+}
+
+// decoderFor возвращает декодер события; ok=false — запись идёт по общему пути.
+func decoderFor(event string) (EventDecoder, bool) {
+	d, ok := decoders[event]
+	return d, ok
+}
+
+func init() {
+	lock := EventDecoder{Keys: []string{"Regions", "Locks", "WaitConnections"}, Decode: decodeLock}
+	RegisterDecoder("TLOCK", lock)
+	RegisterDecoder("TTIMEOUT", lock)
+	RegisterDecoder("TDEADLOCK", EventDecoder{Keys: []string{"DeadlockConnectionIntersections"}, Decode: decodeDeadlock})
+
+	call := EventDecoder{
+		Keys:   []string{"Interface", "IName", "Method", "MName", "CpuTime", "Memory", "MemoryPeak", "InBytes", "OutBytes"},
+		Decode: decodeCall,
+	}
+	RegisterDecoder("CALL", call)
+	RegisterDecoder("SCALL", call)
+
+	RegisterDecoder("EXCP", EventDecoder{Keys: []string{"Exception", "Descr"}, Decode: decodeException})
+
+	sql := EventDecoder{Keys: []string{"Sql", "planSQLText"}, Decode: decodeSQL}
+	RegisterDecoder("DBMSSQL", sql)
+	RegisterDecoder("DBPOSTGRS", sql)
+}
+
+// decodeLock — TLOCK/TTIMEOUT: пространства блокировок, список блокировок и ожидаемые соединения
+func decodeLock(entry *models.LogEntry, header map[string]string) {
+	entry.Lock = &models.LockEvent{
+		Regions:         splitList(header["Regions"]),
+		Locks:           header["Locks"],
+		WaitConnections: parseUint32List(header["WaitConnections"]),
+	}
+}
+
+// decodeDeadlock — TDEADLOCK: жертва (соединение, получившее событие) и участники взаимоблокировки.
+// DeadlockConnectionIntersections имеет вид "12 34 Region Mode Fields,34 12 Region Mode Fields".
+func decodeDeadlock(entry *models.LogEntry, header map[string]string) {
+	intersections := header["DeadlockConnectionIntersections"]
+	seen := make(map[uint32]struct{})
+	var participants []uint32
+	for _, item := range strings.Split(intersections, ",") {
+		fields := strings.Fields(item)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, f := range fields[:2] {
+			id := parseUint32(f)
+			if id == 0 {
+				continue
+			}
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				participants = append(participants, id)
+			}
+		}
+	}
+	entry.Deadlock = &models.DeadlockEvent{
+		Victim:        entry.ConnectID,
+		Participants:  participants,
+		Intersections: intersections,
+	}
+}
+
+// decodeCall — CALL/SCALL: интерфейс, метод и потреблённые ресурсы
+func decodeCall(entry *models.LogEntry, header map[string]string) {
+	iface := header["Interface"]
+	if iface == "" {
+		iface = header["IName"]
+	}
+	method := header["Method"]
+	if method == "" {
+		method = header["MName"]
+	}
+	entry.Call = &models.CallEvent{
+		Interface:  iface,
+		Method:     method,
+		CpuTime:    parseUint64(header["CpuTime"]),
+		Memory:     parseInt64(header["Memory"]),
+		MemoryPeak: parseInt64(header["MemoryPeak"]),
+		InBytes:    parseUint64(header["InBytes"]),
+		OutBytes:   parseUint64(header["OutBytes"]),
+	}
+}
+
+// decodeException — EXCP: класс исключения и описание ошибки
+func decodeException(entry *models.LogEntry, header map[string]string) {
+	entry.Exception = &models.ExceptionEvent{
+		Exception: header["Exception"],
+		Descr:     header["Descr"],
+	}
+}
+
+// decodeSQL — DBMSSQL/DBPOSTGRS: текст запроса, его шаблон с отпечатком
+// и план запроса (при включённом plansql в logcfg.xml)
+func decodeSQL(entry *models.LogEntry, header map[string]string) {
+	dialect := dialectForEvent(entry.EventName)
+	entry.SQL = extractSQL(header["Sql"])
+	entry.SQLNormalized = NormalizeSQL(entry.SQL, dialect)
+	entry.SQLHash = SQLHash(entry.SQLNormalized)
+	entry.Plan = ParsePlan(header["planSQLText"], dialect)
+}
+
+// splitList разбивает список через запятую, отбрасывая пустые элементы
+func splitList(s string) []string {
+	var res []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// parseUint32List разбирает список номеров соединений через запятую
+func parseUint32List(s string) []uint32 {
+	var res []uint32
+	for _, item := range splitList(s) {
+		res = append(res, parseUint32(item))
+	}
+	return res
+}
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Assembler собирает строки файла в записи
+// (RecordAssembler для техжурнала, LineAssembler для построчных форматов)
+type Assembler interface {
+	// Push добавляет строку без перевода строки; size — её размер в файле в байтах
+	Push(line string, size int64) []Record
+	// Flush возвращает недособранную запись (конец файла, остановка чтения)
+	Flush() (Record, bool)
+	// Pending сообщает, есть ли недособранная запись
+	Pending() bool
+}
+
+// Parser — формат лог-файла: как резать строки на записи и как разбирать запись в LogEntry.
+// Parse при ошибке возвращает частично заполненную запись вместе с ошибкой.
+type Parser interface {
+	NewAssembler(offset int64) Assembler
+	Parse(record Record) (models.LogEntry, error)
+}
+
+// TechLog — технологический журнал 1С
+var TechLog Parser = techLogParser{}
+
+type techLogParser struct{}
+
+func (techLogParser) NewAssembler(offset int64) Assembler {
+	return &RecordAssembler{Offset: offset}
+}
+
+// Parse разбирает запись техжурнала; EventTime не заполняется — время записи
+// содержит только минуты и секунды, час берётся из имени файла
+func (techLogParser) Parse(record Record) (models.LogEntry, error) {
+	return ParseRecord(record.Text)
+}
+
+// LineAssembler — каждая непустая строка является отдельной записью
+type LineAssembler struct {
+	Offset int64 // Смещение в файле, с которого читается следующая строка
+}
+
+func (a *LineAssembler) Push(line string, size int64) []Record {
+	start := a.Offset
+	a.Offset += size
+	line = strings.TrimSuffix(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	return []Record{{Text: line, Offset: start, End: a.Offset}}
+}
+
+func (a *LineAssembler) Flush() (Record, bool) { return Record{}, false }
+
+func (a *LineAssembler) Pending() bool { return false }
+
+// FieldOptions — как раскладывать поля построчных форматов (JSON, regex) по LogEntry
+type FieldOptions struct {
+	Event      string            // имя события для всех записей, если в записи нет поля event
+	TimeLayout string            // формат поля time в нотации Go; пусто — RFC3339
+	Location   *time.Location    // часовой пояс для времени без зоны; nil — UTC
+	Fields     map[string]string // исходное имя поля -> стандартное имя (time, event, user…)
+}
+
+// fieldSetters — стандартные имена полей и куда они попадают в LogEntry.
+// Остальные поля записи уходят в Properties.
+var fieldSetters = map[string]func(e *models.LogEntry, v string){
+	"event":       func(e *models.LogEntry, v string) { e.EventName = v },
+	"duration":    func(e *models.LogEntry, v string) { e.Duration = parseUint64(v) },
+	"user":        func(e *models.LogEntry, v string) { e.User = v },
+	"session":     func(e *models.LogEntry, v string) { e.SessionID = parseUint64(v) },
+	"computer":    func(e *models.LogEntry, v string) { e.ComputerName = v },
+	"application": func(e *models.LogEntry, v string) { e.ApplicationName = v },
+	"process":     func(e *models.LogEntry, v string) { e.ProcessName = v },
+	"database":    func(e *models.LogEntry, v string) { e.Database = v },
+	"sql":         func(e *models.LogEntry, v string) { e.SQL = v },
+	"context": func(e *models.LogEntry, v string) {
+		e.Context = extractContext(v)
+		e.ContextFrames = ParseContext(e.Context)
+	},
+}
+
+// applyFields раскладывает именованные поля записи по LogEntry
+func (o FieldOptions) applyFields(fields map[string]string) (models.LogEntry, error) {
+	entry := models.LogEntry{EventName: o.Event, InsertedAt: time.Now()}
+	var timeValue string
+	for name, value := range fields {
+		std := strings.ToLower(name)
+		if mapped, ok := o.Fields[name]; ok {
+			std = strings.ToLower(mapped)
+		}
+		if std == "time" {
+			timeValue = value
+			continue
+		}
+		if set, ok := fieldSetters[std]; ok && value != "" {
+			set(&entry, value)
+			continue
+		}
+		if entry.Properties == nil {
+			entry.Properties = make(map[string]string)
+		}
+		entry.Properties[name] = value
+	}
+	if timeValue == "" {
+		return entry, fmt.Errorf("%w: нет поля time", ErrBadTime)
+	}
+	t, err := o.parseTime(timeValue)
+	if err != nil {
+		return entry, err
+	}
+	entry.EventTime = t
+	entry.LogTimestamp = t.Format("04:05.000000")
+	return entry, nil
+}
+
+// parseTime разбирает время по TimeLayout; "unix" и "unixms" — секунды и миллисекунды эпохи
+func (o FieldOptions) parseTime(s string) (time.Time, error) {
+	layout := o.TimeLayout
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	loc := o.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	switch layout {
+	case "unix":
+		sec, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: %q", ErrBadTime, s)
+		}
+		return time.Unix(0, int64(sec*float64(time.Second))).In(loc), nil
+	case "unixms":
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: %q", ErrBadTime, s)
+		}
+		return time.UnixMilli(ms).In(loc), nil
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrBadTime, err)
+	}
+	return t, nil
+}
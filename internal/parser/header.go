@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// headerTimeRegex — время внутри часа: 4 знака дробной части в 8.2, 6 — в 8.3
+var headerTimeRegex = regexp.MustCompile(`^\d{2}:[0-5]\d\.\d{1,6}$`)
+
+// RecordHeader — позиционная часть записи техжурнала: "mm:ss.ffffff-длительность,СОБЫТИЕ,уровень".
+type RecordHeader struct {
+	Time      string // Время внутри часа: "mm:ss.ffffff" (8.3) или "mm:ss.ffff" (8.2)
+	Duration  uint64 // Длительность события в микросекундах
+	EventName string // Имя события: DBMSSQL, TLOCK, CALL, ...
+	Depth     uint8  // Уровень вложенности события
+}
+
+// ParseHeader разбирает позиционные поля записи.
+// Длительность пишется в тех же единицах, что и дробная часть секунд:
+// в 8.3 — микросекунды (6 знаков), в 8.2 — десятитысячные доли секунды (4 знака).
+// Ошибка ErrBadHeader — нет имени события или длительности, ErrBadTime — время не в формате mm:ss.ffffff.
+func ParseHeader(props []Property) (RecordHeader, error) {
+	var h RecordHeader
+	positional := 0
+	for _, p := range props {
+		if p.Key != "" {
+			continue
+		}
+		switch positional {
+		case 0:
+			h.Time, h.Duration = parseTimeDuration(p.Value)
+		case 1:
+			h.EventName = p.Value
+		case 2:
+			h.Depth = parseUint8(p.Value)
+		}
+		positional++
+		if positional > 2 {
+			break
+		}
+	}
+	if positional < 2 || h.EventName == "" {
+		return h, fmt.Errorf("%w: нет имени события", ErrBadHeader)
+	}
+	if !headerTimeRegex.MatchString(h.Time) {
+		return h, fmt.Errorf("%w: %q", ErrBadTime, h.Time)
+	}
+	return h, nil
+}
+
+// parseTimeDuration разбирает "mm:ss.ffffff-длительность" и приводит длительность к микросекундам
+func parseTimeDuration(s string) (string, uint64) {
+	s = strings.TrimPrefix(s, "\uFEFF")
+	ts, dur, found := strings.Cut(s, "-")
+	if !found {
+		return ts, 0
+	}
+	duration := parseUint64(dur)
+	if dot := strings.IndexByte(ts, '.'); dot >= 0 {
+		for digits := len(ts) - dot - 1; digits < 6; digits++ {
+			duration *= 10
+		}
+	}
+	return ts, duration
+}
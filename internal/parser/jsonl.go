@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONParser разбирает логи в формате JSON Lines: одна строка — один объект.
+// Вложенные объекты и массивы попадают в Properties в виде JSON.
+type JSONParser struct {
+	Options FieldOptions
+}
+
+// NewJSONParser создаёт парсер JSON Lines
+func NewJSONParser(opts FieldOptions) *JSONParser {
+	return &JSONParser{Options: opts}
+}
+
+func (p *JSONParser) NewAssembler(offset int64) Assembler {
+	return &LineAssembler{Offset: offset}
+}
+
+func (p *JSONParser) Parse(record Record) (models.LogEntry, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(record.Text), &obj); err != nil {
+		return models.LogEntry{EventName: p.Options.Event}, fmt.Errorf("%w: %v", ErrBadRecord, err)
+	}
+	fields := make(map[string]string, len(obj))
+	for k, raw := range obj {
+		fields[k] = jsonString(raw)
+	}
+	return p.Options.applyFields(fields)
+}
+
+// jsonString превращает значение JSON в строку: строки без кавычек, null — пусто, остальное как есть
+func jsonString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s
+		}
+	}
+	return string(raw)
+}
@@ -11,15 +11,24 @@ import (
 // lines — это массив строк, который может содержать как одну, так и несколько связанных строк (multi-line SQL/Context).
 // Возвращает полностью заполненную структуру LogEntry.
 func ParseLine(lines []string) (models.LogEntry, error) {
-	raw := strings.Join(lines, "\n")
-	header, sql, context := ParseLogRecord(raw)
+	return ParseRecord(strings.Join(lines, "\n"))
+}
+
+// ParseRecord парсит одну собранную запись техжурнала (см. RecordAssembler) в LogEntry.
+// При ошибке разбора возвращается частично заполненная запись и ошибка
+// (ErrUnterminatedQuote, ErrBadHeader, ErrBadTime).
+func ParseRecord(raw string) (models.LogEntry, error) {
+	props, tokErr := Tokenize(raw)
+	rh, hdrErr := ParseHeader(props)
+	header := headerFromProperties(props)
+	context := extractContext(header["Context"])
 
 	entry := models.LogEntry{
 		Timestamp:       safe(header, "Timestamp"),
-		LogTimestamp:    safe(header, "LogTimestamp"),
-		Component:       safe(header, "Component"),
-		Severity:        parseUint8(safe(header, "Severity")),
-		Level:           safe(header, "level"),
+		LogTimestamp:    rh.Time,
+		Duration:        rh.Duration,
+		EventName:       rh.EventName,
+		Depth:           rh.Depth,
 		Process:         safe(header, "process"),
 		ProcessName:     safe(header, "p:processName"),
 		OSThread:        parseUint32(safe(header, "OSThread")),
@@ -33,60 +42,101 @@ func ParseLine(lines []string) (models.LogEntry, error) {
 		Database:        safe(header, "DataBase"),
 		Trans:           parseUint32(safe(header, "Trans")),
 		DBPID:           parseUint32(safe(header, "dbpid")),
-		SQL:             sql,
 		Rows:            parseInt32(safe(header, "Rows")),
 		RowsAffected:    parseInt32(safe(header, "RowsAffected")),
 		Context:         context,
-		EventType:       safe(header, "Event"),
-		File:            safe(header, "File"),
+		ContextFrames:   ParseContext(context),
 		InsertedAt:      time.Now(),
 	}
+
+	// Типизированная часть — по декодеру события, неизвестные события идут общим путём
+	var decoderKeys []string
+	if d, ok := decoderFor(entry.EventName); ok {
+		d.Decode(&entry, header)
+		decoderKeys = d.Keys
+	}
+	entry.Properties = extraProperties(props, decoderKeys)
+
+	if hdrErr != nil {
+		return entry, hdrErr
+	}
+	if tokErr != nil {
+		return entry, tokErr
+	}
 	return entry, nil
 }
 
+// knownKeys — свойства, которые ParseLine раскладывает по полям LogEntry.
+// Все остальные свойства попадают в LogEntry.Properties.
+var knownKeys = map[string]struct{}{
+	"process":           {},
+	"p:processName":     {},
+	"OSThread":          {},
+	"t:clientID":        {},
+	"t:applicationName": {},
+	"t:computerName":    {},
+	"t:connectID":       {},
+	"SessionID":         {},
+	"Usr":               {},
+	"DBMS":              {},
+	"DataBase":          {},
+	"Trans":             {},
+	"dbpid":             {},
+	"Rows":              {},
+	"RowsAffected":      {},
+	"Context":           {},
+}
+
 // --- Парсер сырого текста ---
 
-// ParseLogRecord разбивает сырой текст лога на шапку, SQL и Context.
-func ParseLogRecord(raw string) (header map[string]string, sql string, context string) {
-	header = make(map[string]string)
-	sqlIdx := strings.Index(raw, "Sql=")
-	if sqlIdx == -1 {
-		return parseSimpleHeader(raw), "", extractContext(raw)
-	}
-	headerPart := raw[:sqlIdx]
-	sqlAndAfter := raw[sqlIdx+4:]
-	if len(sqlAndAfter) == 0 {
-		return parseSimpleHeader(headerPart), "", ""
+// headerFromProperties раскладывает именованные свойства записи в map.
+// Позиционные поля разбирает ParseHeader, для повторяющихся ключей остаётся первое значение.
+func headerFromProperties(props []Property) map[string]string {
+	res := make(map[string]string, len(props))
+	for _, p := range props {
+		if p.Key == "" {
+			continue
+		}
+		if _, exists := res[p.Key]; !exists {
+			res[p.Key] = p.Value
+		}
 	}
-	quote := sqlAndAfter[0]
-	sqlAndAfter = sqlAndAfter[1:]
-	sqlText, afterSQL := extractSQL(sqlAndAfter, quote)
-	contextText := extractContext(afterSQL)
-	return parseSimpleHeader(headerPart), sqlText, contextText
+	return res
 }
 
-func parseSimpleHeader(headerRaw string) map[string]string {
+// extraProperties собирает свойства, не вошедшие в фиксированные поля LogEntry.
+// skip — свойства, уже разобранные декодером события.
+// Значения повторяющихся ключей объединяются через перевод строки.
+func extraProperties(props []Property, skip []string) map[string]string {
 	res := make(map[string]string)
-	parts := strings.Split(headerRaw, ",")
-	if len(parts) > 0 {
-		res["LogTimestamp"] = strings.TrimSpace(parts[0])
-	}
-	if len(parts) > 1 {
-		res["Component"] = strings.TrimSpace(parts[1])
-	}
-	if len(parts) > 2 {
-		res["Severity"] = strings.TrimSpace(parts[2])
-	}
-	for _, part := range parts[3:] {
-		if eq := strings.Index(part, "="); eq > 0 {
-			k := strings.TrimSpace(part[:eq])
-			v := strings.Trim(part[eq+1:], " '")
-			res[k] = v
+	for _, p := range props {
+		if p.Key == "" {
+			continue
+		}
+		if _, known := knownKeys[p.Key]; known {
+			continue
+		}
+		if containsString(skip, p.Key) {
+			continue
+		}
+		if prev, exists := res[p.Key]; exists {
+			res[p.Key] = prev + "\n" + p.Value
+			continue
 		}
+		res[p.Key] = p.Value
 	}
 	return res
 }
 
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // --- Безопасные преобразования ---
 func safe(m map[string]string, k string) string {
 	if v, ok := m[k]; ok {
@@ -114,3 +164,8 @@ func parseInt32(s string) int32 {
 	n, _ := strconv.ParseInt(s, 10, 32)
 	return int32(n)
 }
+
+func parseInt64(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
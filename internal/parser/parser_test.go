@@ -0,0 +1,30 @@
+package parser
+
+import "testing"
+
+func TestParseRecordRows(t *testing.T) {
+	tests := []struct {
+		name         string
+		raw          string
+		rows         int32
+		rowsAffected int32
+	}{
+		{"SDBL", "10:00.000001-12,SDBL,3,process=rphost,Func=Select,Rows=5,RowsAffected=0", 5, 0},
+		{"DBV8DBENG", "10:00.000002-7,DBV8DBENG,4,process=rphost,Sql='SELECT 1',Rows=2,RowsAffected=1", 2, 1},
+		{"DBMSSQL", "10:00.000003-9,DBMSSQL,4,process=rphost,Sql='SELECT 1',Rows=7,RowsAffected=-1", 7, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := ParseRecord(tt.raw)
+			if err != nil {
+				t.Fatalf("ParseRecord: %v", err)
+			}
+			if entry.Rows != tt.rows || entry.RowsAffected != tt.rowsAffected {
+				t.Errorf("Rows, RowsAffected = %d, %d, want %d, %d", entry.Rows, entry.RowsAffected, tt.rows, tt.rowsAffected)
+			}
+			if _, ok := entry.Properties["Rows"]; ok {
+				t.Errorf("Rows попал в Properties")
+			}
+		})
+	}
+}
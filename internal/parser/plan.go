@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Операторы плана MS SQL (текстовый showplan) и PostgreSQL (EXPLAIN)
+	planScanRegex = regexp.MustCompile(`\b(Table Scan|Clustered Index Scan|Index Scan|Seq Scan|Parallel Seq Scan)\b`)
+	planSeekRegex = regexp.MustCompile(`\b(Clustered Index Seek|Index Seek|Index Only Scan|Bitmap Index Scan)\b`)
+	// Оценка строк в плане PostgreSQL: "(cost=0.00..1.23 rows=10 width=4)"
+	pgPlanRowsRegex = regexp.MustCompile(`\brows=(\d+)`)
+)
+
+// ParsePlan разбирает значение planSQLText в сводку по плану запроса.
+// В MS SQL каждая строка плана начинается с числовых колонок
+// "Rows, Executes, EstimateRows, EstimateIO, ..." и оператора после "|--",
+// в PostgreSQL — текст EXPLAIN с оценками "rows=N". Оценка строк берётся
+// с корневого (первого) оператора.
+func ParsePlan(plan, dialect string) *models.SQLPlan {
+	plan = strings.TrimSpace(plan)
+	if plan == "" {
+		return nil
+	}
+	res := &models.SQLPlan{Text: plan}
+	rootFound := false
+	for _, line := range strings.Split(plan, "\n") {
+		// в PostgreSQL "Index Scan" — поиск по индексу, а не сканирование
+		if dialect == DialectPostgres {
+			switch {
+			case strings.Contains(line, "Index Only Scan"), strings.Contains(line, "Bitmap Index Scan"),
+				strings.Contains(line, "Index Scan"):
+				res.Seeks++
+			case strings.Contains(line, "Seq Scan"):
+				res.Scans++
+			}
+		} else {
+			if planSeekRegex.MatchString(line) {
+				res.Seeks++
+			} else if planScanRegex.MatchString(line) {
+				res.Scans++
+			}
+		}
+
+		if rootFound {
+			continue
+		}
+		if rows, ok := estimatedRows(line, dialect); ok {
+			res.EstimatedRows = rows
+			rootFound = true
+		}
+	}
+	return res
+}
+
+// estimatedRows извлекает оценку строк из строки плана
+func estimatedRows(line, dialect string) (float64, bool) {
+	if dialect == DialectPostgres {
+		m := pgPlanRowsRegex.FindStringSubmatch(line)
+		if m == nil {
+			return 0, false
+		}
+		n, err := strconv.ParseFloat(m[1], 64)
+		return n, err == nil
+	}
+	op := strings.Index(line, "|--")
+	if op < 0 {
+		return 0, false
+	}
+	cols := strings.Split(line[:op], ",")
+	if len(cols) < 3 {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(cols[2]), 64)
+	return n, err == nil
+}
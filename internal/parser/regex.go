@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RegexParser разбирает строки регулярным выражением с именованными группами
+// (веб-логи Apache/IIS, логи RAS). Имена групп — стандартные имена полей (time, event, user…)
+// или произвольные: такие группы попадают в Properties.
+type RegexParser struct {
+	Options FieldOptions
+	re      *regexp.Regexp
+}
+
+// NewRegexParser компилирует выражение; в нём должна быть хотя бы группа time
+func NewRegexParser(pattern string, opts FieldOptions) (*RegexParser, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compile pattern: %w", err)
+	}
+	if re.SubexpIndex("time") < 0 && !hasMappedTime(re, opts.Fields) {
+		return nil, fmt.Errorf("в выражении нет именованной группы time")
+	}
+	return &RegexParser{Options: opts, re: re}, nil
+}
+
+func hasMappedTime(re *regexp.Regexp, fields map[string]string) bool {
+	for name, std := range fields {
+		if strings.EqualFold(std, "time") && re.SubexpIndex(name) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RegexParser) NewAssembler(offset int64) Assembler {
+	return &LineAssembler{Offset: offset}
+}
+
+func (p *RegexParser) Parse(record Record) (models.LogEntry, error) {
+	m := p.re.FindStringSubmatch(record.Text)
+	if m == nil {
+		return models.LogEntry{EventName: p.Options.Event}, fmt.Errorf("%w: строка не совпала с выражением", ErrBadRecord)
+	}
+	fields := make(map[string]string, len(m))
+	for i, name := range p.re.SubexpNames() {
+		if name != "" && m[i] != "" {
+			fields[name] = m[i]
+		}
+	}
+	return p.Options.applyFields(fields)
+}
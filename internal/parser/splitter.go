@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// recordHeaderRegex — полная шапка записи "mm:ss.ffffff-длительность,СОБЫТИЕ,уровень,".
+// Внутри кавычек новой записью считается только такая строка: значение свойства
+// вряд ли начнётся с полной шапки, а незакрытая кавычка (обрыв записи при падении 1С)
+// иначе поглотила бы все следующие записи до DefaultMaxRecordSize.
+var recordHeaderRegex = regexp.MustCompile(`^\x{FEFF}?\d{2}:[0-5]\d\.\d{4,6}-\d+,[A-Za-z]\w*,\d+,`)
+
+// DefaultMaxRecordSize — предел размера одной записи; защищает от бесконечной записи
+// при незакрытой кавычке в повреждённом файле
+const DefaultMaxRecordSize = 32 << 20
+
+// Record — собранная запись техжурнала и её положение в исходном файле.
+// Offset — смещение первого байта записи, End — смещение сразу после неё.
+type Record struct {
+	Text   string
+	Offset int64
+	End    int64
+}
+
+// RecordAssembler собирает строки техжурнала в записи.
+// Запись считается завершённой, когда строка заканчивается вне кавычек:
+// 1С заключает в кавычки любое значение с переводами строк, поэтому многострочные
+// Sql=/Context= никогда не разрываются, а таймеры ожидания не нужны.
+type RecordAssembler struct {
+	MaxRecordSize int   // 0 — DefaultMaxRecordSize
+	Offset        int64 // Смещение в файле, с которого читается следующая строка
+
+	buf   strings.Builder
+	start int64
+	state int
+	quote byte
+}
+
+// Push добавляет строку (без завершающего перевода строки) и возвращает готовые записи.
+// size — сколько байт строка занимала в файле вместе с переводом строки.
+func (a *RecordAssembler) Push(line string, size int64) []Record {
+	line = strings.TrimSuffix(line, "\r")
+	var out []Record
+	defer func() { a.Offset += size }()
+
+	if a.buf.Len() == 0 {
+		if strings.TrimSpace(line) == "" {
+			return nil
+		}
+		a.start = a.Offset
+		a.state = stateKey
+	} else if recordHeaderRegex.MatchString(line) {
+		// предыдущая запись оборвана внутри кавычек (например, при падении процесса 1С):
+		// отдаём её как есть — при разборе она получит ErrUnterminatedQuote и уйдёт в карантин
+		out = append(out, a.take(a.Offset))
+		a.start = a.Offset
+		a.state = stateKey
+	} else {
+		a.buf.WriteByte('\n')
+	}
+	a.buf.WriteString(line)
+	a.scan(line)
+
+	limit := a.MaxRecordSize
+	if limit <= 0 {
+		limit = DefaultMaxRecordSize
+	}
+	if a.state != stateQuoted || a.buf.Len() >= limit {
+		out = append(out, a.take(a.Offset+size))
+	}
+	return out
+}
+
+// Flush возвращает недособранную запись, если она есть (конец файла, остановка чтения)
+func (a *RecordAssembler) Flush() (Record, bool) {
+	if a.buf.Len() == 0 {
+		return Record{}, false
+	}
+	return a.take(a.Offset), true
+}
+
+// Pending сообщает, есть ли недособранная запись
+func (a *RecordAssembler) Pending() bool {
+	return a.buf.Len() > 0
+}
+
+func (a *RecordAssembler) take(end int64) Record {
+	rec := Record{Text: a.buf.String(), Offset: a.start, End: end}
+	a.buf.Reset()
+	a.state = stateKey
+	a.quote = 0
+	return rec
+}
+
+// scan продвигает состояние кавычек по строке; автомат совпадает с Tokenize
+func (a *RecordAssembler) scan(line string) {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch a.state {
+		case stateKey:
+			if c == '=' {
+				a.state = stateValue
+			}
+		case stateValue:
+			switch c {
+			case '\'', '"':
+				a.quote = c
+				a.state = stateQuoted
+			case ',':
+				a.state = stateKey
+			case ' ', '\t':
+			default:
+				// значение без кавычек: кавычка внутри него уже не открывает строку
+				a.state = stateUnquoted
+			}
+		case stateUnquoted:
+			if c == ',' {
+				a.state = stateKey
+			}
+		case stateQuoted:
+			if c == a.quote {
+				if i+1 < len(line) && line[i+1] == a.quote {
+					i++
+					continue
+				}
+				a.state = stateAfterQuote
+			}
+		case stateAfterQuote:
+			if c == ',' {
+				a.state = stateKey
+			}
+		}
+	}
+	if a.state == stateValue || a.state == stateUnquoted {
+		// значение без кавычек заканчивается вместе со строкой
+		a.state = stateKey
+	}
+}
@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assemble прогоняет текст через RecordAssembler построчно, как это делает watcher
+func assemble(t *testing.T, text string, maxSize int) []Record {
+	t.Helper()
+	a := RecordAssembler{MaxRecordSize: maxSize}
+	var out []Record
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		out = append(out, a.Push(strings.TrimSuffix(line, "\n"), int64(len(line)))...)
+	}
+	if rec, ok := a.Flush(); ok {
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestRecordAssembler(t *testing.T) {
+	const (
+		call   = "00:01.000001-5,CALL,0,process=rphost,Memory=10\r\n"
+		sql    = "00:02.000002-7,DBMSSQL,4,Sql='SELECT 1\r\nFROM T\r\nWHERE a = ''x'''\r\n"
+		broken = "00:03.000003-1,EXCP,1,Descr='обрыв записи\r\nпродолжение\r\n"
+		tlock  = "00:04.000004-2,TLOCK,5,Locks='Reference42'\r\n"
+	)
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "однострочные записи",
+			text: call + tlock,
+			want: []string{call, tlock},
+		},
+		{
+			name: "многострочное значение в кавычках",
+			text: sql + call,
+			want: []string{sql, call},
+		},
+		{
+			name: "незакрытая кавычка закрывается на шапке следующей записи",
+			text: broken + tlock + call,
+			want: []string{broken, tlock, call},
+		},
+		{
+			name: "незакрытая кавычка в конце файла",
+			text: call + broken,
+			want: []string{call, broken},
+		},
+		{
+			name: "строка с временем без имени события внутри кавычек — часть значения",
+			text: "00:05.000005-3,EXCP,1,Descr='строка\r\n00:06.123456-0, не шапка'\r\n" + call,
+			want: []string{"00:05.000005-3,EXCP,1,Descr='строка\r\n00:06.123456-0, не шапка'\r\n", call},
+		},
+		{
+			name: "пустые строки между записями пропускаются",
+			text: call + "\r\n" + tlock,
+			want: []string{call, tlock},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := assemble(t, tt.text, 0)
+			var got []string
+			for _, rec := range records {
+				got = append(got, tt.text[rec.Offset:rec.End])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("записи:\n got %q\nwant %q", got, tt.want)
+			}
+			for i, rec := range records {
+				want := strings.ReplaceAll(strings.TrimSuffix(tt.want[i], "\r\n"), "\r\n", "\n")
+				if rec.Text != want {
+					t.Errorf("Text[%d] = %q, want %q", i, rec.Text, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordAssemblerBrokenRecordQuarantined(t *testing.T) {
+	records := assemble(t, "00:03.000003-1,EXCP,1,Descr='обрыв\r\n00:04.000004-2,TLOCK,5,Locks=''\r\n", 0)
+	if len(records) != 2 {
+		t.Fatalf("записей %d, want 2", len(records))
+	}
+	if _, err := ParseRecord(records[0].Text); !errors.Is(err, ErrUnterminatedQuote) {
+		t.Errorf("оборванная запись: err = %v, want ErrUnterminatedQuote", err)
+	}
+	if entry, err := ParseRecord(records[1].Text); err != nil || entry.EventName != "TLOCK" {
+		t.Errorf("следующая запись: %q, %v", entry.EventName, err)
+	}
+}
+
+func TestRecordAssemblerMaxRecordSize(t *testing.T) {
+	text := "00:01.000001-1,EXCP,1,Descr='" + strings.Repeat("x", 100) + "\r\n" + strings.Repeat("y", 100) + "\r\n"
+	records := assemble(t, text, 64)
+	if len(records) != 2 {
+		t.Fatalf("записей %d, want 2", len(records))
+	}
+	if records[0].End != records[1].Offset || records[1].End != int64(len(text)) {
+		t.Errorf("смещения %+v", records)
+	}
+}
@@ -0,0 +1,183 @@
+package parser
+
+import (
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+// Диалекты SQL, которые пишет 1С в техжурнал
+const (
+	DialectMSSQL    = "mssql"
+	DialectPostgres = "postgres"
+)
+
+var (
+	// Строки значений параметров, которые 1С дописывает после текста запроса: "p_0: 0x8F2B..."
+	sqlParamLineRegex = regexp.MustCompile(`(?m)^\s*p_\d+:.*$`)
+	// Временные таблицы: #tt12 в MS SQL, tt12 в PostgreSQL
+	sqlTempTableRegex = regexp.MustCompile(`#tt\d+`)
+	pgTempTableRegex  = regexp.MustCompile(`\b(pg_temp\.)?tt\d+\b`)
+	// Списки значений IN (?, ?, ?), в том числе из параметров IN (@P?, @P?) и IN ($?, $?),
+	// сворачиваются в один плейсхолдер: иначе каждая длина списка давала бы свой SQLHash
+	sqlInListRegex = regexp.MustCompile(`(?i)\bIN\s*\(\s*(?:\?|@P\?|\$\?)(?:\s*,\s*(?:\?|@P\?|\$\?))*\s*\)`)
+)
+
+// NormalizeSQL приводит текст запроса к шаблону для группировки:
+// строковые и числовые литералы заменяются на ?, параметры @P1/$1 — на @P?/$?,
+// имена временных таблиц — на #tt?/tt?, списки IN (...) сворачиваются, пробелы схлопываются.
+// Идентификаторы в [] и "" не изменяются.
+func NormalizeSQL(sql, dialect string) string {
+	sql = sqlParamLineRegex.ReplaceAllString(sql, "")
+
+	var b strings.Builder
+	b.Grow(len(sql))
+	space := false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			space = true
+			continue
+		}
+		if space {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+		}
+
+		switch {
+		case c == '\'':
+			// строковый литерал; N'...' (MS SQL) и E'...' (PostgreSQL) — тоже литералы,
+			// причём в E'...' кавычку можно экранировать обратной косой чертой: E'a\'b'
+			escapes := false
+			if out := b.String(); len(out) > 0 && strings.IndexByte("NnEe", out[len(out)-1]) >= 0 &&
+				(len(out) == 1 || !isIdentByte(out[len(out)-2])) {
+				escapes = out[len(out)-1] == 'E' || out[len(out)-1] == 'e'
+				trimLast(&b)
+			}
+			i = skipQuoted(sql, i, '\'', escapes)
+			b.WriteByte('?')
+		case c == '[' && dialect == DialectMSSQL:
+			end := strings.IndexByte(sql[i:], ']')
+			if end < 0 {
+				end = len(sql) - i - 1
+			}
+			b.WriteString(sql[i : i+end+1])
+			i += end
+		case c == '"':
+			end := skipQuoted(sql, i, '"', false)
+			b.WriteString(sql[i : end+1])
+			i = end
+		case c == '@' && i+1 < len(sql) && (sql[i+1] == 'P' || sql[i+1] == 'p') && i+2 < len(sql) && isDigit(sql[i+2]):
+			j := i + 2
+			for j < len(sql) && isDigit(sql[j]) {
+				j++
+			}
+			b.WriteString("@P?")
+			i = j - 1
+		case c == '$' && i+1 < len(sql) && isDigit(sql[i+1]):
+			j := i + 1
+			for j < len(sql) && isDigit(sql[j]) {
+				j++
+			}
+			b.WriteString("$?")
+			i = j - 1
+		case isDigit(c) && !prevIsIdent(&b):
+			j := i
+			if c == '0' && i+1 < len(sql) && (sql[i+1] == 'x' || sql[i+1] == 'X') {
+				j += 2
+				for j < len(sql) && isHexDigit(sql[j]) {
+					j++
+				}
+			} else {
+				for j < len(sql) && (isDigit(sql[j]) || sql[j] == '.') {
+					j++
+				}
+				if j < len(sql) && (sql[j] == 'e' || sql[j] == 'E') {
+					j++
+					if j < len(sql) && (sql[j] == '+' || sql[j] == '-') {
+						j++
+					}
+					for j < len(sql) && isDigit(sql[j]) {
+						j++
+					}
+				}
+			}
+			b.WriteByte('?')
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	res := b.String()
+	if dialect == DialectPostgres {
+		res = pgTempTableRegex.ReplaceAllString(res, "${1}tt?")
+	} else {
+		res = sqlTempTableRegex.ReplaceAllString(res, "#tt?")
+	}
+	return sqlInListRegex.ReplaceAllString(res, "IN (...)")
+}
+
+// SQLHash — 64-битный отпечаток нормализованного запроса (FNV-1a)
+func SQLHash(normalized string) uint64 {
+	if normalized == "" {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(normalized))
+	return h.Sum64()
+}
+
+// dialectForEvent определяет диалект SQL по имени события
+func dialectForEvent(event string) string {
+	if event == "DBPOSTGRS" {
+		return DialectPostgres
+	}
+	return DialectMSSQL
+}
+
+// skipQuoted возвращает индекс закрывающей кавычки с учётом удвоения,
+// а при escapes — и экранирования обратной косой чертой
+func skipQuoted(s string, start int, quote byte, escapes bool) int {
+	for i := start + 1; i < len(s); i++ {
+		if escapes && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(s) - 1
+}
+
+func trimLast(b *strings.Builder) {
+	s := b.String()
+	b.Reset()
+	b.WriteString(s[:len(s)-1])
+}
+
+func prevIsIdent(b *strings.Builder) bool {
+	s := b.String()
+	return len(s) > 0 && isIdentByte(s[len(s)-1])
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '#' || c == '@' || c == '$' || c == '.' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || isDigit(c) || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
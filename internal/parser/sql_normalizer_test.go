@@ -0,0 +1,72 @@
+package parser
+
+import "testing"
+
+func TestNormalizeSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		dialect string
+		want    string
+	}{
+		{
+			name:    "литералы и временные таблицы MS SQL",
+			sql:     "SELECT T1._Fld1 FROM #tt12 T1 WHERE T1._Fld2 = N'abc' AND T1._Fld3 > 10.5\np_0: 0x8F2B",
+			dialect: DialectMSSQL,
+			want:    "SELECT T1._Fld1 FROM #tt? T1 WHERE T1._Fld2 = ? AND T1._Fld3 > ?",
+		},
+		{
+			name:    "IN из литералов",
+			sql:     "SELECT 1 FROM T WHERE a IN (1, 2, 'x')",
+			dialect: DialectMSSQL,
+			want:    "SELECT ? FROM T WHERE a IN (...)",
+		},
+		{
+			name:    "IN из параметров MS SQL",
+			sql:     "SELECT 1 FROM T WHERE a IN (@P1, @P2,@P3)",
+			dialect: DialectMSSQL,
+			want:    "SELECT ? FROM T WHERE a IN (...)",
+		},
+		{
+			name:    "IN из параметров PostgreSQL",
+			sql:     "SELECT 1 FROM tt5 WHERE a IN ($1,\n $2, $3, $4)",
+			dialect: DialectPostgres,
+			want:    "SELECT ? FROM tt? WHERE a IN (...)",
+		},
+		{
+			name:    "экранирование в E'...' PostgreSQL",
+			sql:     "SELECT 1 FROM t WHERE d=E'a\\'b' AND e = e'c\\\\' AND f = 'x\\'",
+			dialect: DialectPostgres,
+			want:    "SELECT ? FROM t WHERE d=? AND e = ? AND f = ?",
+		},
+		{
+			name:    "вложенный запрос не сворачивается",
+			sql:     "SELECT 1 FROM T WHERE a IN (SELECT b FROM U)",
+			dialect: DialectMSSQL,
+			want:    "SELECT ? FROM T WHERE a IN (SELECT b FROM U)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeSQL(tt.sql, tt.dialect); got != tt.want {
+				t.Errorf("NormalizeSQL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLHashIgnoresInListLength(t *testing.T) {
+	tests := []struct {
+		dialect string
+		a, b    string
+	}{
+		{DialectMSSQL, "SELECT * FROM T WHERE a IN (@P1)", "SELECT * FROM T WHERE a IN (@P1, @P2, @P3)"},
+		{DialectPostgres, "SELECT * FROM t WHERE a IN ($1, $2)", "SELECT * FROM t WHERE a IN ($1, $2, $3, $4, $5)"},
+	}
+	for _, tt := range tests {
+		a, b := SQLHash(NormalizeSQL(tt.a, tt.dialect)), SQLHash(NormalizeSQL(tt.b, tt.dialect))
+		if a != b {
+			t.Errorf("%s: разные отпечатки для %q и %q", tt.dialect, tt.a, tt.b)
+		}
+	}
+}
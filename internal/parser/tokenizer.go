@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Property — пара ключ/значение из записи технологического журнала.
+// Для позиционных полей шапки (время-длительность, событие, уровень) Key пустой.
+type Property struct {
+	Key   string
+	Value string
+}
+
+// состояния автомата токенизатора
+const (
+	stateKey = iota
+	stateValue
+	stateQuoted
+	stateAfterQuote
+	stateUnquoted // значение без кавычек (используется сборщиком записей)
+)
+
+// Tokenize разбирает запись техжурнала на упорядоченный список свойств.
+// Значения могут быть заключены в ' или ", удвоенная кавычка внутри значения
+// означает саму кавычку (так пишет 1С). Запятые и переводы строк внутри кавычек
+// считаются частью значения. Повторяющиеся ключи сохраняются в порядке следования.
+// При незакрытой кавычке остаток строки попадает в последнее значение
+// и возвращается ErrUnterminatedQuote вместе с разобранными свойствами.
+func Tokenize(s string) ([]Property, error) {
+	var (
+		props []Property
+		key   strings.Builder
+		val   strings.Builder
+		quote byte
+		state = stateKey
+	)
+
+	emit := func() {
+		k := strings.TrimSpace(key.String())
+		v := val.String()
+		if state != stateAfterQuote {
+			v = strings.TrimSpace(v)
+		}
+		if k != "" || v != "" || state == stateAfterQuote {
+			props = append(props, Property{Key: k, Value: v})
+		}
+		key.Reset()
+		val.Reset()
+		state = stateKey
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch state {
+		case stateKey:
+			switch c {
+			case '=':
+				state = stateValue
+			case ',':
+				// поле без '=' — позиционное: значение без ключа
+				val.WriteString(key.String())
+				key.Reset()
+				emit()
+			default:
+				key.WriteByte(c)
+			}
+		case stateValue:
+			switch {
+			case (c == '\'' || c == '"') && strings.TrimSpace(val.String()) == "":
+				val.Reset()
+				quote = c
+				state = stateQuoted
+			case c == ',':
+				emit()
+			default:
+				val.WriteByte(c)
+			}
+		case stateQuoted:
+			if c == quote {
+				if i+1 < len(s) && s[i+1] == quote {
+					val.WriteByte(c)
+					i++
+					continue
+				}
+				state = stateAfterQuote
+				continue
+			}
+			val.WriteByte(c)
+		case stateAfterQuote:
+			if c == ',' {
+				emit()
+			}
+			// мусор между закрывающей кавычкой и запятой игнорируем
+		}
+	}
+
+	if state == stateKey {
+		val.WriteString(key.String())
+		key.Reset()
+	}
+	var err error
+	if state == stateQuoted {
+		err = fmt.Errorf("%w: свойство %q", ErrUnterminatedQuote, strings.TrimSpace(key.String()))
+	}
+	emit()
+	return props, err
+}
@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Property
+	}{
+		{
+			name: "TLOCK с вложенными кавычками",
+			in:   `45:31.831006-1,TLOCK,5,process=rphost,Usr=Иванов,Regions=AccumRg1234.DIMS,Locks='AccumRg1234.DIMS Exclusive Fld1="abc" Period=''2025''',WaitConnections=,Context='Форма.Вызов : ОбщийМодуль.Модуль.Процедура'`,
+			want: []Property{
+				{Value: "45:31.831006-1"},
+				{Value: "TLOCK"},
+				{Value: "5"},
+				{Key: "process", Value: "rphost"},
+				{Key: "Usr", Value: "Иванов"},
+				{Key: "Regions", Value: "AccumRg1234.DIMS"},
+				{Key: "Locks", Value: `AccumRg1234.DIMS Exclusive Fld1="abc" Period='2025'`},
+				{Key: "WaitConnections"},
+				{Key: "Context", Value: "Форма.Вызов : ОбщийМодуль.Модуль.Процедура"},
+			},
+		},
+		{
+			name: "EXCP с переводами строк и запятыми в описании",
+			in: "12:01.000001-0,EXCP,1,process=rmngr,Exception=580392e6-ba49-4280-ac67-fcd6f2180121,Descr=\"src\\VResourceInfoBaseServerImpl.cpp(1016):\r\n" +
+				"580392e6: Ошибка при выполнении операции, \"\"таблица\"\" заблокирована\",Context=",
+			want: []Property{
+				{Value: "12:01.000001-0"},
+				{Value: "EXCP"},
+				{Value: "1"},
+				{Key: "process", Value: "rmngr"},
+				{Key: "Exception", Value: "580392e6-ba49-4280-ac67-fcd6f2180121"},
+				{Key: "Descr", Value: "src\\VResourceInfoBaseServerImpl.cpp(1016):\r\n580392e6: Ошибка при выполнении операции, \"таблица\" заблокирована"},
+				{Key: "Context"},
+			},
+		},
+		{
+			name: "DBMSSQL с текстом запроса",
+			in: "07:15.123456-15002,DBMSSQL,4,process=rphost,dbpid=57,Sql=\"SELECT T1._IDRRef, 'a,b' FROM dbo._Reference42 T1 WHERE T1._Code = @P1\n" +
+				"p_0: 'X''Y'\n\",Rows=1,RowsAffected=-1,Context='ВнешняяОбработка.Модуль : 10 : Выборка = Запрос.Выполнить();'",
+			want: []Property{
+				{Value: "07:15.123456-15002"},
+				{Value: "DBMSSQL"},
+				{Value: "4"},
+				{Key: "process", Value: "rphost"},
+				{Key: "dbpid", Value: "57"},
+				{Key: "Sql", Value: "SELECT T1._IDRRef, 'a,b' FROM dbo._Reference42 T1 WHERE T1._Code = @P1\np_0: 'X''Y'\n"},
+				{Key: "Rows", Value: "1"},
+				{Key: "RowsAffected", Value: "-1"},
+				{Key: "Context", Value: "ВнешняяОбработка.Модуль : 10 : Выборка = Запрос.Выполнить();"},
+			},
+		},
+		{
+			name: "CALL с повторяющимися ключами",
+			in:   `33:02.500000-250000,CALL,0,process=rphost,p:processName=demo,Module=ОбщийМодуль,Method=Выполнить,CallID=1,Memory=1024,MemoryPeak=4096,CallID=2`,
+			want: []Property{
+				{Value: "33:02.500000-250000"},
+				{Value: "CALL"},
+				{Value: "0"},
+				{Key: "process", Value: "rphost"},
+				{Key: "p:processName", Value: "demo"},
+				{Key: "Module", Value: "ОбщийМодуль"},
+				{Key: "Method", Value: "Выполнить"},
+				{Key: "CallID", Value: "1"},
+				{Key: "Memory", Value: "1024"},
+				{Key: "MemoryPeak", Value: "4096"},
+				{Key: "CallID", Value: "2"},
+			},
+		},
+		{
+			name: "пустое значение в кавычках",
+			in:   `Descr='',Usr=`,
+			want: []Property{
+				{Key: "Descr"},
+				{Key: "Usr"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Tokenize(tt.in)
+			if err != nil {
+				t.Fatalf("Tokenize: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize:\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeUnterminatedQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Property
+	}{
+		{
+			name: "одинарная кавычка",
+			in:   "01:00.000000-0,EXCP,1,Descr='Ошибка, текст оборван\nна середине",
+			want: []Property{
+				{Value: "01:00.000000-0"},
+				{Value: "EXCP"},
+				{Value: "1"},
+				{Key: "Descr", Value: "Ошибка, текст оборван\nна середине"},
+			},
+		},
+		{
+			name: "удвоенная кавычка в конце не закрывает значение",
+			in:   `Sql="SELECT ""a""`,
+			want: []Property{
+				{Key: "Sql", Value: `SELECT "a"`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Tokenize(tt.in)
+			if !errors.Is(err, ErrUnterminatedQuote) {
+				t.Fatalf("Tokenize: err = %v, want ErrUnterminatedQuote", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize:\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
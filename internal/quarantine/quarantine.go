@@ -0,0 +1,58 @@
+package quarantine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Record — запись, которую не удалось разобрать или преобразовать.
+// Хранит исходный текст, чтобы её можно было переобработать после исправления парсера.
+type Record struct {
+	Time   time.Time `json:"time"`   // Когда запись попала в карантин
+	File   string    `json:"file"`   // Путь к файлу лога
+	Offset int64     `json:"offset"` // Смещение записи в файле
+	Reason string    `json:"reason"` // Причина: текст ошибки разбора
+	Raw    string    `json:"raw"`    // Исходный текст записи
+}
+
+// Sink — приёмник карантина (таблица ClickHouse или локальный файл)
+type Sink interface {
+	Write(ctx context.Context, records []Record) error
+}
+
+// FileSink дописывает записи карантина в файл в формате JSON Lines
+type FileSink struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{Path: path}
+}
+
+func (f *FileSink) Write(ctx context.Context, records []Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if dir := filepath.Dir(f.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("create quarantine dir: %w", err)
+		}
+	}
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open quarantine file: %w", err)
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("write quarantine: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package spool
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Формат сегмента: последовательность записей «длина данных (uint32 LE), CRC-32C данных (uint32 LE), данные».
+// Данные — batch записей в JSON. Курсор подтверждения (файл ack) хранит конец последней
+// подтверждённой записи: «номер сегмента смещение».
+const (
+	headerSize = 8
+	segmentExt = ".seg"
+	ackFile    = "ack"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrClosed — спул закрыт
+var ErrClosed = errors.New("спул закрыт")
+
+// errCorrupt — запись сегмента повреждена (не совпала контрольная сумма или обрезана)
+var errCorrupt = errors.New("запись спула повреждена")
+
+// Options — ограничения спула
+type Options struct {
+	MaxSegmentSize int64 // размер сегмента, после которого начинается новый
+	MaxSize        int64 // предел всех сегментов на диске; при заполнении Append ждёт подтверждений
+}
+
+// ID — положение записи в спуле
+type ID struct {
+	Segment uint64
+	Offset  int64
+	Size    int64 // вместе с заголовком
+}
+
+func (id ID) end() int64 { return id.Offset + id.Size }
+
+// Spool — дисковый буфер batch-ей перед отправкой в ClickHouse (write-ahead).
+// Batch записывается в сегмент и синхронизируется на диск до отправки, а после
+// подтверждения вставки (Ack) сегменты, в которых не осталось неподтверждённых записей,
+// удаляются. При старте неподтверждённые записи отдаются заново.
+type Spool struct {
+	dir    string
+	opts   Options
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	closed   bool
+	segments map[uint64]int64 // номер сегмента -> размер на диске
+	total    int64
+	pending  []ID // неподтверждённые записи по порядку
+
+	w     *os.File
+	wSeq  uint64
+	wSize int64
+}
+
+// Open открывает спул в каталоге dir: проверяет контрольные суммы сегментов,
+// удаляет подтверждённые сегменты и обрезает недописанную запись в конце последнего сегмента
+func Open(dir string, opts Options, logger *zap.Logger) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+	s := &Spool{dir: dir, opts: opts, logger: logger, segments: make(map[uint64]int64)}
+	s.cond = sync.NewCond(&s.mu)
+
+	seqs, err := s.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	ackSeg, ackOff := s.readAck()
+
+	for i, seq := range seqs {
+		path := s.segmentPath(seq)
+		if seq < ackSeg {
+			if err := os.Remove(path); err != nil {
+				return nil, fmt.Errorf("remove acked segment: %w", err)
+			}
+			continue
+		}
+		ids, good, err := scanSegment(path, seq)
+		if err != nil && !errors.Is(err, errCorrupt) {
+			return nil, err
+		}
+		if errors.Is(err, errCorrupt) {
+			if i == len(seqs)-1 {
+				// обрыв записи при падении процесса: недописанный хвост отбрасываем
+				logger.Warn("Обрезан недописанный хвост сегмента спула", zap.String("segment", path), zap.Int64("offset", good))
+				if err := os.Truncate(path, good); err != nil {
+					return nil, fmt.Errorf("truncate segment: %w", err)
+				}
+			} else {
+				logger.Error("Сегмент спула повреждён, остаток сегмента пропущен", zap.String("segment", path), zap.Int64("offset", good))
+			}
+		}
+		for _, id := range ids {
+			if seq == ackSeg && id.end() <= ackOff {
+				continue
+			}
+			s.pending = append(s.pending, id)
+		}
+		if info, err := os.Stat(path); err == nil {
+			s.segments[seq] = info.Size()
+			s.total += info.Size()
+		}
+		s.wSeq = seq
+	}
+	if len(s.pending) > 0 {
+		logger.Info("В спуле есть неотправленные batch-и", zap.Int("count", len(s.pending)))
+	}
+	if s.wSeq < ackSeg {
+		s.wSeq = ackSeg
+	}
+	// запись всегда начинается в новом сегменте: старые сегменты только читаются
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	s.removeAcked()
+	return s, nil
+}
+
+// Append записывает batch на диск. Если спул заполнен, ждёт подтверждения
+// отправленных batch-ей или отмены ctx.
+func (s *Spool) Append(ctx context.Context, batch []models.LogEntry) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("marshal batch: %w", err)
+	}
+	size := int64(headerSize + len(data))
+
+	stop := context.AfterFunc(ctx, s.wake)
+	defer stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.closed && s.opts.MaxSize > 0 && s.total+size > s.opts.MaxSize && len(s.pending) > 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.cond.Wait()
+	}
+	if s.closed {
+		return ErrClosed
+	}
+	if s.wSize > 0 && s.opts.MaxSegmentSize > 0 && s.wSize+size > s.opts.MaxSegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, size)
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(data, crcTable))
+	copy(buf[headerSize:], data)
+	if _, err := s.w.Write(buf); err != nil {
+		return fmt.Errorf("write spool: %w", err)
+	}
+	if err := s.w.Sync(); err != nil {
+		return fmt.Errorf("sync spool: %w", err)
+	}
+
+	s.pending = append(s.pending, ID{Segment: s.wSeq, Offset: s.wSize, Size: size})
+	s.wSize += size
+	s.segments[s.wSeq] = s.wSize
+	s.total += size
+	s.cond.Broadcast()
+	return nil
+}
+
+// Next возвращает самый старый неподтверждённый batch, ожидая его появления.
+// Повреждённые записи пропускаются с ошибкой в журнале.
+func (s *Spool) Next(ctx context.Context) (ID, []models.LogEntry, error) {
+	stop := context.AfterFunc(ctx, s.wake)
+	defer stop()
+
+	for {
+		s.mu.Lock()
+		for !s.closed && len(s.pending) == 0 && ctx.Err() == nil {
+			s.cond.Wait()
+		}
+		if ctx.Err() != nil {
+			s.mu.Unlock()
+			return ID{}, nil, ctx.Err()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return ID{}, nil, ErrClosed
+		}
+		id := s.pending[0]
+		s.mu.Unlock()
+
+		batch, err := s.read(id)
+		if err == nil {
+			return id, batch, nil
+		}
+		s.logger.Error("Не удалось прочитать batch из спула, запись пропущена",
+			zap.Uint64("segment", id.Segment), zap.Int64("offset", id.Offset), zap.Error(err))
+		if err := s.Ack(id); err != nil {
+			return ID{}, nil, err
+		}
+	}
+}
+
+// Ack подтверждает отправку самого старого batch-а и удаляет освободившиеся сегменты
+func (s *Spool) Ack(id ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 || s.pending[0] != id {
+		return fmt.Errorf("ack: batch %d:%d не первый в очереди", id.Segment, id.Offset)
+	}
+	s.pending = s.pending[1:]
+	if err := s.writeAck(id.Segment, id.end()); err != nil {
+		return err
+	}
+	s.removeAcked()
+	s.cond.Broadcast()
+	return nil
+}
+
+// Close закрывает текущий сегмент; неподтверждённые batch-и остаются на диске до следующего запуска
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.cond.Broadcast()
+	return s.w.Close()
+}
+
+func (s *Spool) wake() {
+	s.mu.Lock()
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// removeAcked удаляет сегменты, все записи которых подтверждены (кроме сегмента, в который идёт запись)
+func (s *Spool) removeAcked() {
+	oldest := s.wSeq
+	if len(s.pending) > 0 {
+		oldest = s.pending[0].Segment
+	}
+	for seq, size := range s.segments {
+		if seq >= oldest {
+			continue
+		}
+		if err := os.Remove(s.segmentPath(seq)); err != nil && !os.IsNotExist(err) {
+			s.logger.Error("Не удалось удалить сегмент спула", zap.Uint64("segment", seq), zap.Error(err))
+			continue
+		}
+		delete(s.segments, seq)
+		s.total -= size
+	}
+}
+
+// rotate начинает новый сегмент
+func (s *Spool) rotate() error {
+	if s.w != nil {
+		if err := s.w.Close(); err != nil {
+			return fmt.Errorf("close segment: %w", err)
+		}
+	}
+	s.wSeq++
+	f, err := os.OpenFile(s.segmentPath(s.wSeq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("create segment: %w", err)
+	}
+	s.w, s.wSize = f, 0
+	s.segments[s.wSeq] = 0
+	return nil
+}
+
+func (s *Spool) read(id ID) ([]models.LogEntry, error) {
+	f, err := os.Open(s.segmentPath(id.Segment))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, id.Size)
+	if _, err := f.ReadAt(buf, id.Offset); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorrupt, err)
+	}
+	data, err := checkRecord(buf)
+	if err != nil {
+		return nil, err
+	}
+	var batch []models.LogEntry
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorrupt, err)
+	}
+	return batch, nil
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016d%s", seq, segmentExt))
+}
+
+func (s *Spool) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spool dir: %w", err)
+	}
+	var seqs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// readAck читает курсор подтверждения; без файла подтверждённых записей нет
+func (s *Spool) readAck() (uint64, int64) {
+	data, err := os.ReadFile(filepath.Join(s.dir, ackFile))
+	if err != nil {
+		return 0, 0
+	}
+	var (
+		seg uint64
+		off int64
+	)
+	if _, err := fmt.Sscanf(string(data), "%d %d", &seg, &off); err != nil {
+		s.logger.Warn("Курсор спула повреждён, все записи будут отправлены заново", zap.Error(err))
+		return 0, 0
+	}
+	return seg, off
+}
+
+// writeAck атомарно перезаписывает курсор подтверждения
+func (s *Spool) writeAck(seg uint64, off int64) error {
+	path := filepath.Join(s.dir, ackFile)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("write ack: %w", err)
+	}
+	if _, err := fmt.Fprintf(f, "%d %d\n", seg, off); err != nil {
+		f.Close()
+		return fmt.Errorf("write ack: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync ack: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write ack: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// scanSegment проверяет записи сегмента и возвращает их положения.
+// good — смещение после последней целой записи; при повреждении возвращается errCorrupt.
+func scanSegment(path string, seq uint64) (ids []ID, good int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("open segment: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("stat segment: %w", err)
+	}
+	r := bufio.NewReader(f)
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return ids, good, nil
+			}
+			return ids, good, fmt.Errorf("%w: %v", errCorrupt, err)
+		}
+		n := binary.LittleEndian.Uint32(header[0:4])
+		if good+headerSize+int64(n) > info.Size() {
+			return ids, good, fmt.Errorf("%w: запись длиннее сегмента", errCorrupt)
+		}
+		rec := make([]byte, headerSize+int(n))
+		copy(rec, header)
+		if _, err := io.ReadFull(r, rec[headerSize:]); err != nil {
+			return ids, good, fmt.Errorf("%w: %v", errCorrupt, err)
+		}
+		if _, err := checkRecord(rec); err != nil {
+			return ids, good, err
+		}
+		ids = append(ids, ID{Segment: seq, Offset: good, Size: int64(len(rec))})
+		good += int64(len(rec))
+	}
+}
+
+// checkRecord проверяет длину и контрольную сумму записи и возвращает её данные
+func checkRecord(rec []byte) ([]byte, error) {
+	if len(rec) < headerSize {
+		return nil, errCorrupt
+	}
+	n := binary.LittleEndian.Uint32(rec[0:4])
+	data := rec[headerSize:]
+	if int(n) != len(data) {
+		return nil, fmt.Errorf("%w: длина %d вместо %d", errCorrupt, len(data), n)
+	}
+	if crc32.Checksum(data, crcTable) != binary.LittleEndian.Uint32(rec[4:8]) {
+		return nil, fmt.Errorf("%w: контрольная сумма не совпала", errCorrupt)
+	}
+	return data, nil
+}
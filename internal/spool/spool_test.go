@@ -0,0 +1,193 @@
+package spool
+
+import (
+	"1CLogPumpClickHouse/internal/models"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func batchOf(offset int64) []models.LogEntry {
+	return []models.LogEntry{{File: "/logs/25052607.log", Offset: offset, End: offset + 10, Raw: "00:01.000001-1,CALL,0"}}
+}
+
+func openSpool(t *testing.T, dir string, opts Options) *Spool {
+	t.Helper()
+	s, err := Open(dir, opts, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// next возвращает очередной batch, не дожидаясь появления нового
+func next(t *testing.T, s *Spool) (ID, []models.LogEntry) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	id, batch, err := s.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	return id, batch
+}
+
+// expectOffsets проверяет, что спул отдаёт batch-и с указанными смещениями по порядку и больше ничего
+func expectOffsets(t *testing.T, s *Spool, offsets ...int64) {
+	t.Helper()
+	for _, off := range offsets {
+		id, batch := next(t, s)
+		if len(batch) != 1 || batch[0].Offset != off {
+			t.Fatalf("получен batch %v, ожидалось смещение %d", batch, off)
+		}
+		if err := s.Ack(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, batch, err := s.Next(ctx); err == nil {
+		t.Fatalf("лишний batch %v", batch)
+	}
+}
+
+func TestReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpool(t, dir, Options{})
+	for _, off := range []int64{0, 10, 20} {
+		if err := s.Append(context.Background(), batchOf(off)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id, _ := next(t, s)
+	if err := s.Ack(id); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// подтверждённый batch не отдаётся, неподтверждённые — по порядку
+	s = openSpool(t, dir, Options{})
+	defer s.Close()
+	expectOffsets(t, s, 10, 20)
+}
+
+func TestTornTailIsTruncated(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpool(t, dir, Options{})
+	for _, off := range []int64{0, 10} {
+		if err := s.Append(context.Background(), batchOf(off)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seg, size := s.wSeq, s.wSize
+	s.Close()
+
+	// процесс упал посреди записи третьего batch-а
+	f, err := os.OpenFile(s.segmentPath(seg), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{200, 0, 0, 0, 1, 2, 3, 4, '[', '{'})
+	f.Close()
+
+	s = openSpool(t, dir, Options{})
+	defer s.Close()
+	if info, err := os.Stat(s.segmentPath(seg)); err != nil || info.Size() != size {
+		t.Fatalf("хвост сегмента не обрезан: %v", err)
+	}
+	if err := s.Append(context.Background(), batchOf(20)); err != nil {
+		t.Fatal(err)
+	}
+	expectOffsets(t, s, 0, 10, 20)
+}
+
+func TestChecksumMismatchSkipsCorruptRecords(t *testing.T) {
+	dir := t.TempDir()
+	// каждый batch в своём сегменте
+	s := openSpool(t, dir, Options{MaxSegmentSize: 1})
+	for _, off := range []int64{0, 10, 20} {
+		if err := s.Append(context.Background(), batchOf(off)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := s.pending[0]
+	s.Close()
+
+	// повреждены данные первого сегмента (не последнего): остаток сегмента пропускается при открытии
+	corrupt(t, s.segmentPath(first.Segment), first.Offset+headerSize+2)
+	s = openSpool(t, dir, Options{MaxSegmentSize: 1})
+	defer s.Close()
+	if len(s.pending) != 2 {
+		t.Fatalf("неподтверждённых batch-ей %d, want 2", len(s.pending))
+	}
+
+	// повреждение после открытия обнаруживается при чтении: запись пропускается
+	second := s.pending[0]
+	corrupt(t, s.segmentPath(second.Segment), second.Offset+headerSize+2)
+	if _, err := s.read(second); !errors.Is(err, errCorrupt) {
+		t.Fatalf("read: %v, want errCorrupt", err)
+	}
+	expectOffsets(t, s, 20)
+}
+
+// corrupt меняет байт файла path по смещению off
+func corrupt(t *testing.T, path string, off int64) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xFF
+	if _, err := f.WriteAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendWaitsAtMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpool(t, dir, Options{MaxSize: 150})
+	defer s.Close()
+	if err := s.Append(context.Background(), batchOf(0)); err != nil {
+		t.Fatal(err)
+	}
+	if s.total+s.pending[0].Size <= s.opts.MaxSize {
+		t.Fatalf("второй batch помещается в MaxSize: total %d", s.total)
+	}
+
+	// спул заполнен: Append ждёт подтверждения или отмены
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Append(ctx, batchOf(10)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Append в заполненный спул: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Append(context.Background(), batchOf(20)) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Append не дождался места: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	id, _ := next(t, s)
+	if err := s.Ack(id); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Append не продолжился после подтверждения")
+	}
+	expectOffsets(t, s, 20)
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBucket — bucket состояний: путь -> FileState в JSON
+var boltBucket = []byte("processed")
+
+// BoltStore хранит состояния файлов во встроенной базе bbolt. Save записывает
+// изменившиеся файлы одной транзакцией с fsync, поэтому база переживает
+// отключение питания и не переписывается целиком при сотнях тысяч файлов.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore открывает (или создаёт) базу по пути path
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create bolt dir: %w", err)
+	}
+	// база открыта одним процессом: второй экземпляр сервиса не дождётся блокировки
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt: %w", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create bolt bucket: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (b *BoltStore) Load() (map[string]FileState, error) {
+	processed := make(map[string]FileState)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			state, err := decodeState(v)
+			if err != nil {
+				return fmt.Errorf("state of %s: %w", k, err)
+			}
+			processed[string(k)] = state
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return processed, nil
+}
+
+func (b *BoltStore) Save(changed map[string]FileState, removed []string) error {
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		for path, state := range changed {
+			v, err := json.Marshal(state)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(path), v); err != nil {
+				return err
+			}
+		}
+		for _, path := range removed {
+			if err := bucket.Delete([]byte(path)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("save offsets: %w", err)
+	}
+	return nil
+}
+
+// Close закрывает базу
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
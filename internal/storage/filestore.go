@@ -1,42 +1,173 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"sync"
 )
 
+// minCompact — сколько записей журнала копится, прежде чем состояние переписывается целиком
+const minCompact = 1000
+
+// FileStore хранит состояния в JSON-файле Path. Save дописывает изменения в журнал
+// Path + ".journal" (строка JSON на файл), а сам файл переписывается, только когда
+// журнал становится длиннее состояния: сохранение после batch-а не переписывает
+// состояние всех отслеживаемых файлов.
 type FileStore struct {
 	Path string
 	mu   sync.Mutex // добавляем мьютекс для защиты при записи
+
+	state     map[string]FileState // содержимое Path с применённым журналом; nil — ещё не прочитано
+	journaled int                  // записей в журнале
+}
+
+// journalRecord — строка журнала: новое состояние файла или его удаление (State == nil)
+type journalRecord struct {
+	Path  string     `json:"path"`
+	State *FileState `json:"state,omitempty"`
 }
 
 func NewFileStore(path string) *FileStore {
 	return &FileStore{Path: path}
 }
 
-func (f *FileStore) Load() (map[string]int64, error) {
-	processed := make(map[string]int64)
-	if _, err := os.Stat(f.Path); os.IsNotExist(err) {
-		return processed, nil
-	}
-	bs, err := ioutil.ReadFile(f.Path)
-	if err != nil {
+func (f *FileStore) Load() (map[string]FileState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(); err != nil {
 		return nil, err
 	}
-	if err := json.Unmarshal(bs, &processed); err != nil {
-		return nil, err
+	processed := make(map[string]FileState, len(f.state))
+	for path, state := range f.state {
+		processed[path] = state
 	}
 	return processed, nil
 }
 
-func (f *FileStore) Save(data map[string]int64) error {
+// load читает файл состояния и применяет к нему журнал
+func (f *FileStore) load() error {
+	state := make(map[string]FileState)
+	bs, err := ioutil.ReadFile(f.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(bs) > 0 {
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(bs, &raw); err != nil {
+			return err
+		}
+		for path, v := range raw {
+			st, err := decodeState(v)
+			if err != nil {
+				return fmt.Errorf("state of %s: %w", path, err)
+			}
+			state[path] = st
+		}
+	}
+	journaled := 0
+	bs, err = ioutil.ReadFile(f.journalPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// good — длина журнала до первой повреждённой строки
+	good := 0
+	for good < len(bs) {
+		n := bytes.IndexByte(bs[good:], '\n')
+		if n < 0 {
+			break
+		}
+		var rec journalRecord
+		if err := json.Unmarshal(bs[good:good+n], &rec); err != nil {
+			break
+		}
+		if rec.State == nil {
+			delete(state, rec.Path)
+		} else {
+			state[rec.Path] = *rec.State
+		}
+		journaled++
+		good += n + 1
+	}
+	if good < len(bs) {
+		// недописанная при сбое последняя строка: отрезаем, чтобы новые записи не склеились с ней
+		if err := os.Truncate(f.journalPath(), int64(good)); err != nil {
+			return fmt.Errorf("truncate journal: %w", err)
+		}
+	}
+	f.state, f.journaled = state, journaled
+	return nil
+}
+
+// decodeState разбирает состояние файла: объект FileState или, в прежнем формате, одно смещение
+func decodeState(v []byte) (FileState, error) {
+	var state FileState
+	if len(v) > 0 && v[0] == '{' {
+		err := json.Unmarshal(v, &state)
+		return state, err
+	}
+	err := json.Unmarshal(v, &state.Offset)
+	return state, err
+}
+
+func (f *FileStore) Save(changed map[string]FileState, removed []string) error {
 	f.mu.Lock() // начинаем критическую секцию
 	defer f.mu.Unlock()
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+	if f.state == nil {
+		if err := f.load(); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for path, state := range changed {
+		if err := enc.Encode(journalRecord{Path: path, State: &state}); err != nil {
+			return err
+		}
+	}
+	for _, path := range removed {
+		if err := enc.Encode(journalRecord{Path: path}); err != nil {
+			return err
+		}
+	}
+	journal, err := os.OpenFile(f.journalPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = journal.Write(buf.Bytes())
+	if err == nil {
+		err = journal.Sync()
+	}
+	if cerr := journal.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	for path, state := range changed {
+		f.state[path] = state
+	}
+	for _, path := range removed {
+		delete(f.state, path)
+	}
+	f.journaled += len(changed) + len(removed)
+	if f.journaled > max(len(f.state), minCompact) {
+		return f.compact()
+	}
+	return nil
+}
+
+// compact переписывает файл состояния целиком и очищает журнал.
+// Если сбой случится до очистки, журнал просто применится повторно к новому состоянию.
+func (f *FileStore) compact() error {
 	tmp := f.Path + ".tmp"
 	// Кодировка данных в JSON
-	bs, err := json.Marshal(data)
+	bs, err := json.Marshal(f.state)
 	if err != nil {
 		return err
 	}
@@ -44,11 +175,19 @@ func (f *FileStore) Save(data map[string]int64) error {
 	if err := ioutil.WriteFile(tmp, bs, 0644); err != nil {
 		return err
 	}
-	// Удаляем старый файл, чтобы Rename не ошибся (актуально для Windows)
-	_ = os.Remove(f.Path) // игнорируем ошибку, если файла нет
-	// Атомарно переименовываем временный файл в основной
+	// Атомарно заменяем основной файл временным (os.Rename заменяет файл и на Windows):
+	// прежний файл не удаляется заранее, чтобы сбой не оставил журнал без основного файла
 	if err := os.Rename(tmp, f.Path); err != nil {
 		return err
 	}
+	if err := os.Truncate(f.journalPath(), 0); err != nil {
+		return fmt.Errorf("truncate journal: %w", err)
+	}
+	f.journaled = 0
 	return nil
 }
+
+// journalPath возвращает путь к журналу изменений
+func (f *FileStore) journalPath() string {
+	return f.Path + ".journal"
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStoreJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "processed.json")
+	store := NewFileStore(path)
+	if err := store.Save(map[string]FileState{"a.log": {Offset: 10}, "b.log": {Offset: 20, Inode: 7}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(map[string]FileState{"a.log": {Offset: 15}}, []string{"b.log"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("файл состояния переписан до заполнения журнала")
+	}
+
+	got, err := NewFileStore(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got["a.log"].Offset != 15 {
+		t.Errorf("после перезапуска %v", got)
+	}
+
+	// недописанная при сбое строка журнала отбрасывается
+	f, err := os.OpenFile(path+".journal", os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"path":"a.log","state":{"off`)
+	f.Close()
+	store = NewFileStore(path)
+	if got, err = store.Load(); err != nil || got["a.log"].Offset != 15 {
+		t.Errorf("после оборванной строки %v, %v", got, err)
+	}
+	if err := store.Save(map[string]FileState{"c.log": {Offset: 5}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = NewFileStore(path).Load(); err != nil || got["c.log"].Offset != 5 {
+		t.Errorf("запись после оборванной строки потеряна: %v, %v", got, err)
+	}
+}
+
+func TestFileStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "processed.json")
+	store := NewFileStore(path)
+	for i := 0; i <= minCompact; i++ {
+		if err := store.Save(map[string]FileState{"a.log": {Offset: int64(i)}}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, err := os.Stat(path + ".journal"); err != nil || info.Size() != 0 {
+		t.Fatalf("журнал не очищен после сжатия: %v", err)
+	}
+	got, err := NewFileStore(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["a.log"].Offset != minCompact {
+		t.Errorf("смещение после сжатия %d, want %d", got["a.log"].Offset, minCompact)
+	}
+}
@@ -1,7 +1,20 @@
 package storage
 
-// ProcessedStore — интерфейс для загрузки/сохранения списка обработанных файлов.
+// FileState — сохранённое состояние обработки файла: смещение, до которого записи
+// доставлены, и идентичность файла, к которой это смещение относится
+type FileState struct {
+	Offset         int64  `json:"offset"`
+	Dev            uint64 `json:"dev,omitempty"`   // устройство (на Windows — серийный номер тома)
+	Inode          uint64 `json:"inode,omitempty"` // inode (на Windows — индекс файла); 0 — идентичность неизвестна
+	Fingerprint    uint64 `json:"fp,omitempty"`    // хеш первых FingerprintLen байт файла
+	FingerprintLen int    `json:"fplen,omitempty"`
+	Gen            uint64 `json:"gen,omitempty"` // поколение чтения, к которому относится смещение (входит в токен дедупликации)
+}
+
+// ProcessedStore — интерфейс для загрузки/сохранения состояния обработанных файлов.
+// Save получает только состояния, изменившиеся с прошлого сохранения, и пути удалённых,
+// поэтому сохранение после каждого batch-а не зависит от числа отслеживаемых файлов.
 type ProcessedStore interface {
-	Load() (map[string]int64, error)
-	Save(data map[string]int64) error
+	Load() (map[string]FileState, error)
+	Save(changed map[string]FileState, removed []string) error
 }
@@ -3,22 +3,49 @@ package storage
 import (
 	"1CLogPumpClickHouse/internal/config"
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/redis/go-redis/v9"
+	"os"
+	"strconv"
 	"time"
 )
 
+// redisChunk — сколько полей передаётся одной командой HSET/HDEL
+const redisChunk = 1000
+
+// RedisStore хранит смещения в хеше <KeyPrefix><key>:offsets (путь -> смещение),
+// а идентичность файла и сведения о нём на момент сохранения (размер, время изменения) —
+// в хеше <KeyPrefix><key>:meta. Save отправляет изменившиеся файлы одним конвейером.
 type RedisStore struct {
-	client *redis.Client
-	key    string
+	client  *redis.Client
+	legacy  string // множество имён файлов прежнего формата (без префикса)
+	offsets string
+	meta    string
+}
+
+// fileMeta — идентичность файла и сведения о нём на момент сохранения смещения
+type fileMeta struct {
+	Dev            uint64    `json:"dev,omitempty"`
+	Inode          uint64    `json:"ino,omitempty"`
+	Fingerprint    uint64    `json:"fp,omitempty"`
+	FingerprintLen int       `json:"fplen,omitempty"`
+	Gen            uint64    `json:"gen,omitempty"`
+	Size           int64     `json:"size"`
+	MTime          time.Time `json:"mtime"`
 }
 
 func NewRedisStore(cfg *config.RedisConfig, key string) (*RedisStore, error) {
+	tlsConfig, err := cfg.TLS.Build()
+	if err != nil {
+		return nil, fmt.Errorf("redis tls: %w", err)
+	}
 	// Создаём клиента Redis
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Password: cfg.Password,
-		DB:       cfg.DB,
+		Addr:      fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Password:  cfg.Password,
+		DB:        cfg.DB,
+		TLSConfig: tlsConfig,
 	})
 	// Проверяем подключение с тайм-аутом
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -27,28 +54,109 @@ func NewRedisStore(cfg *config.RedisConfig, key string) (*RedisStore, error) {
 		// Соединение не установлено - возвращаем ошибку
 		return nil, fmt.Errorf("не удалось подключиться к Redis: %w", err)
 	}
-	return &RedisStore{client: rdb, key: key}, nil
+	return &RedisStore{
+		client:  rdb,
+		legacy:  key,
+		offsets: cfg.KeyPrefix + key + ":offsets",
+		meta:    cfg.KeyPrefix + key + ":meta",
+	}, nil
 }
 
-func (r *RedisStore) Load() (map[string]int64, error) {
+func (r *RedisStore) Load() (map[string]FileState, error) {
 	ctx := context.Background()
-	members, err := r.client.SMembers(ctx, r.key).Result()
+	if err := r.migrateLegacy(ctx); err != nil {
+		return nil, fmt.Errorf("migrate legacy set: %w", err)
+	}
+	fields, err := r.client.HGetAll(ctx, r.offsets).Result()
+	if err != nil {
+		return nil, err
+	}
+	metas, err := r.client.HGetAll(ctx, r.meta).Result()
 	if err != nil {
 		return nil, err
 	}
-	processed := make(map[string]int64, len(members))
-	for _, m := range members {
-		processed[m] = 0
+	processed := make(map[string]FileState, len(fields))
+	for path, v := range fields {
+		offset, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("offset of %s: %w", path, err)
+		}
+		state := FileState{Offset: offset}
+		var meta fileMeta
+		if raw, ok := metas[path]; ok && json.Unmarshal([]byte(raw), &meta) == nil {
+			state.Dev, state.Inode = meta.Dev, meta.Inode
+			state.Fingerprint, state.FingerprintLen = meta.Fingerprint, meta.FingerprintLen
+			state.Gen = meta.Gen
+		}
+		processed[path] = state
 	}
 	return processed, nil
 }
 
-func (r *RedisStore) Save(data map[string]int64) error {
-	ctx := context.Background()
-	for filename := range data {
-		if err := r.client.SAdd(ctx, r.key, filename).Err(); err != nil {
+// migrateLegacy переносит множество имён файлов прежнего формата в хеш смещений.
+// Смещений прежний формат не хранил, поэтому существующие файлы считаются прочитанными
+// до текущего размера (иначе после перехода они были бы отправлены повторно),
+// а удалённые отбрасываются. Если хеш уже есть, множество не трогается.
+func (r *RedisStore) migrateLegacy(ctx context.Context) error {
+	typ, err := r.client.Type(ctx, r.legacy).Result()
+	if err != nil || typ != "set" {
+		return err
+	}
+	exists, err := r.client.Exists(ctx, r.offsets).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+	members, err := r.client.SMembers(ctx, r.legacy).Result()
+	if err != nil {
+		return err
+	}
+	data := make(map[string]FileState, len(members))
+	for _, path := range members {
+		if info, err := os.Stat(path); err == nil {
+			data[path] = FileState{Offset: info.Size()}
+		}
+	}
+	if err := r.write(ctx, data, nil); err != nil {
+		return err
+	}
+	return r.client.Del(ctx, r.legacy).Err()
+}
+
+func (r *RedisStore) Save(changed map[string]FileState, removed []string) error {
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+	return r.write(context.Background(), changed, removed)
+}
+
+// write записывает смещения и сведения о файлах changed и удаляет removed одним конвейером
+func (r *RedisStore) write(ctx context.Context, changed map[string]FileState, removed []string) error {
+	offsets := make([]interface{}, 0, 2*len(changed))
+	metas := make([]interface{}, 0, 2*len(changed))
+	for path, state := range changed {
+		offsets = append(offsets, path, state.Offset)
+		meta := fileMeta{Dev: state.Dev, Inode: state.Inode, Fingerprint: state.Fingerprint, FingerprintLen: state.FingerprintLen, Gen: state.Gen}
+		if info, err := os.Stat(path); err == nil {
+			meta.Size, meta.MTime = info.Size(), info.ModTime()
+		}
+		bs, err := json.Marshal(meta)
+		if err != nil {
 			return err
 		}
+		metas = append(metas, path, string(bs))
 	}
-	return nil
+	_, err := r.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i := 0; i < len(offsets); i += 2 * redisChunk {
+			end := min(i+2*redisChunk, len(offsets))
+			p.HSet(ctx, r.offsets, offsets[i:end]...)
+			p.HSet(ctx, r.meta, metas[i:end]...)
+		}
+		for i := 0; i < len(removed); i += redisChunk {
+			end := min(i+redisChunk, len(removed))
+			p.HDel(ctx, r.offsets, removed[i:end]...)
+			p.HDel(ctx, r.meta, removed[i:end]...)
+		}
+		return nil
+	})
+	return err
 }
@@ -0,0 +1,109 @@
+package transform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeResolver восстанавливает полное время события техжурнала.
+// Дата и час берутся из имени файла (ГГММДДЧЧ.log), минуты, секунды и доли секунды —
+// из шапки записи. Время в логах 1С — локальное время сервера, поэтому имя файла
+// интерпретируется в часовом поясе источника.
+type TimeResolver struct {
+	loc *time.Location
+}
+
+// NewTimeResolver создаёт резолвер для часового пояса источника (например, "Europe/Moscow").
+// Пустая строка — локальный часовой пояс машины, на которой работает сервис.
+func NewTimeResolver(timeZone string) (*TimeResolver, error) {
+	if timeZone == "" {
+		return &TimeResolver{loc: time.Local}, nil
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("load time zone %q: %w", timeZone, err)
+	}
+	return &TimeResolver{loc: loc}, nil
+}
+
+// Location возвращает часовой пояс источника
+func (r *TimeResolver) Location() *time.Location {
+	return r.loc
+}
+
+// Resolve возвращает время события с точностью до микросекунды.
+// path — путь к файлу лога, logTimestamp — "mm:ss.ffffff" (8.3) или "mm:ss.ffff" (8.2).
+// Если имя файла не соответствует ГГММДДЧЧ, час берётся из времени изменения файла.
+func (r *TimeResolver) Resolve(path, logTimestamp string) (time.Time, error) {
+	offset, err := ParseMinuteSecond(logTimestamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if hour, ok := r.HourFromFileName(filepath.Base(path)); ok {
+		return hour.Add(offset), nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("имя файла %q не содержит часа, mtime недоступен: %w", filepath.Base(path), err)
+	}
+	mod := info.ModTime().In(r.loc)
+	t := mod.Truncate(time.Hour).Add(offset)
+	if t.After(mod) {
+		// запись сделана в прошлом часе, а файл изменён уже в следующем
+		t = t.Add(-time.Hour)
+	}
+	return t, nil
+}
+
+// HourFromFileName разбирает имя файла техжурнала "25052607.log" в начало часа 2025-05-26 07:00
+func (r *TimeResolver) HourFromFileName(name string) (time.Time, bool) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if len(base) != 8 {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("06010215", base, r.loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ParseMinuteSecond разбирает время внутри часа "mm:ss.ffffff" в смещение от начала часа.
+// Дробная часть может содержать от 1 до 6 знаков (8.2 пишет 4, 8.3 — 6).
+func ParseMinuteSecond(s string) (time.Duration, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "\uFEFF")
+	mm, rest, ok := strings.Cut(s, ":")
+	if !ok || len(mm) != 2 {
+		return 0, fmt.Errorf("недопустимый log timestamp: %q", s)
+	}
+	ss, frac, _ := strings.Cut(rest, ".")
+	if len(ss) != 2 || len(frac) > 6 {
+		return 0, fmt.Errorf("недопустимый log timestamp: %q", s)
+	}
+	minutes, err := strconv.Atoi(mm)
+	if err != nil || minutes > 59 {
+		return 0, fmt.Errorf("недопустимые минуты в log timestamp: %q", s)
+	}
+	seconds, err := strconv.Atoi(ss)
+	if err != nil || seconds > 59 {
+		return 0, fmt.Errorf("недопустимые секунды в log timestamp: %q", s)
+	}
+	var micros int
+	if frac != "" {
+		micros, err = strconv.Atoi(frac)
+		if err != nil {
+			return 0, fmt.Errorf("недопустимая дробная часть в log timestamp: %q", s)
+		}
+		for i := len(frac); i < 6; i++ {
+			micros *= 10
+		}
+	}
+	return time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second +
+		time.Duration(micros)*time.Microsecond, nil
+}
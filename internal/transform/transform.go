@@ -3,71 +3,109 @@ package transform
 import (
 	"1CLogPumpClickHouse/internal/models"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
-var timeRegexp = regexp.MustCompile(`\d{2}:\d{2}\.\d{1,6}`)
-
+// TransformLogEntry конвертирует LogEntry в строку таблицы техжурнала.
+// Время события должно быть заранее вычислено TimeResolver-ом.
 func TransformLogEntry(entry models.LogEntry) (models.TechLogRow, error) {
-	// Вытаскиваем дату из имени файла: "25052607.log" → "2025-05-26"
-	ts := entry.Timestamp
-	if len(ts) < 6 {
-		return models.TechLogRow{}, fmt.Errorf("недопустимый timestamp: %s", ts)
-	}
-	parsedDate := fmt.Sprintf("20%s-%s-%s", ts[0:2], ts[2:4], ts[4:6])
-	parsedHour, err := strconv.Atoi(ts[6:8])
-	if err != nil {
-		return models.TechLogRow{}, fmt.Errorf("недопустимый час в timestamp: %q", ts[6:8])
-	}
-
-	// Извлечение времени события из сырых данных
-	raw := entry.LogTimestamp
-	// Удаляем возможный BOM
-	raw = strings.TrimPrefix(raw, "\uFEFF")
-	// Находим первое совпадение по шаблону времени
-	match := timeRegexp.FindString(raw)
-	if match == "" {
-		return models.TechLogRow{}, fmt.Errorf("недопустимый log timestamp: %s", entry.LogTimestamp)
+	if entry.EventTime.IsZero() {
+		return models.TechLogRow{}, fmt.Errorf("не определено время события: файл %q, log timestamp %q", entry.Timestamp, entry.LogTimestamp)
 	}
+	eventTime := entry.EventTime
+	eventDate := time.Date(eventTime.Year(), eventTime.Month(), eventTime.Day(), 0, 0, 0, 0, time.UTC)
 
-	eventTimeStr := fmt.Sprintf("%s %02d:%s", parsedDate, parsedHour, match)
-	// Пытаемся распарсить с дробной частью
-	eventTime, err := time.Parse("2006-01-02 15:04:05.000000", eventTimeStr)
-	if err != nil {
-		// Без дробной части
-		eventTime, err = time.Parse("2006-01-02 15:04:05", eventTimeStr)
-		if err != nil {
-			return models.TechLogRow{}, fmt.Errorf("failed to parse event time: %v", err)
-		}
-	}
-
-	// Количество миллисекунд или произвольного значения после дефиса
-	var duration uint32
-	if parts := strings.SplitN(raw, "-", 2); len(parts) > 1 {
-		if val, err := strconv.ParseUint(parts[1], 10, 32); err == nil {
-			duration = uint32(val)
-		}
-	}
-
-	return models.TechLogRow{
-		EventDate:     parsedDate,
-		EventTime:     eventTime.Format("2006-01-02 15:04:05.999999"),
-		EventType:     entry.Component,
-		Duration:      duration,
+	row := models.TechLogRow{
+		EventDate:     eventDate,
+		EventTime:     eventTime,
+		EventType:     entry.EventName,
+		Duration:      entry.Duration,
 		User:          entry.User,
 		InfoBase:      entry.Database,
-		SessionID:     uint32(entry.SessionID),
+		SessionID:     entry.SessionID,
 		ClientID:      entry.ClientID,
 		ConnectionID:  entry.ConnectID,
 		ExceptionType: nil,
 		ErrorText:     nil,
 		SQLText:       &entry.SQL,
+		SQLNormalized: entry.SQLNormalized,
+		SQLHash:       entry.SQLHash,
 		Rows:          &entry.Rows,
 		RowsAffected:  &entry.RowsAffected,
 		Context:       &entry.Context,
 		ProcessName:   entry.ProcessName,
-	}, nil
+		Properties:    entry.Properties,
+	}
+	applyContextFrames(&row, entry.ContextFrames)
+	applyEventDetails(&row, entry)
+	return row, nil
+}
+
+// applyContextFrames заполняет колонки кадров стека: первый и последний кадр
+// и массив всех кадров в виде "Модуль : Строка : Код"
+func applyContextFrames(row *models.TechLogRow, frames []models.ContextFrame) {
+	row.ContextFrames = make([]string, 0, len(frames))
+	for _, f := range frames {
+		row.ContextFrames = append(row.ContextFrames, formatFrame(f))
+	}
+	if len(row.ContextFrames) > 0 {
+		row.ContextFirstLine = row.ContextFrames[0]
+		row.ContextLastLine = row.ContextFrames[len(row.ContextFrames)-1]
+	}
+}
+
+func formatFrame(f models.ContextFrame) string {
+	parts := []string{f.Module}
+	if f.Line > 0 {
+		parts = append(parts, strconv.FormatUint(uint64(f.Line), 10))
+	}
+	if f.Code != "" {
+		parts = append(parts, f.Code)
+	}
+	return strings.Join(parts, " : ")
+}
+
+// applyEventDetails переносит типизированные данные события в выделенные колонки
+func applyEventDetails(row *models.TechLogRow, entry models.LogEntry) {
+	row.LockRegions = []string{}
+	row.WaitConnections = []uint32{}
+	row.DeadlockParticipants = []uint32{}
+
+	if l := entry.Lock; l != nil {
+		if l.Regions != nil {
+			row.LockRegions = l.Regions
+		}
+		if l.WaitConnections != nil {
+			row.WaitConnections = l.WaitConnections
+		}
+		row.Locks = l.Locks
+	}
+	if d := entry.Deadlock; d != nil {
+		row.DeadlockVictim = d.Victim
+		if d.Participants != nil {
+			row.DeadlockParticipants = d.Participants
+		}
+		row.DeadlockIntersections = d.Intersections
+	}
+	if c := entry.Call; c != nil {
+		row.CallInterface = c.Interface
+		row.CallMethod = c.Method
+		row.CpuTime = c.CpuTime
+		row.Memory = c.Memory
+		row.MemoryPeak = c.MemoryPeak
+		row.InBytes = c.InBytes
+		row.OutBytes = c.OutBytes
+	}
+	if p := entry.Plan; p != nil {
+		row.PlanSQLText = p.Text
+		row.PlanScans = p.Scans
+		row.PlanSeeks = p.Seeks
+		row.PlanEstimatedRows = p.EstimatedRows
+	}
+	if e := entry.Exception; e != nil {
+		row.ExceptionType = &e.Exception
+		row.ErrorText = &e.Descr
+	}
 }
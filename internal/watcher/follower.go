@@ -0,0 +1,139 @@
+package watcher
+
+import (
+	"1CLogPumpClickHouse/internal/charset"
+	"1CLogPumpClickHouse/internal/fileid"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// followPollInterval — как часто проверять дописывание файла после достижения конца
+const followPollInterval = 250 * time.Millisecond
+
+// errTruncated — файл стал короче прочитанного (перезаписан или усечён)
+var errTruncated = errors.New("файл усечён")
+
+// follower читает файл с заданного смещения и отдаёт строки, декодированные в UTF-8,
+// по мере дописывания файла (аналог tail -f). Строки отдаются только целиком,
+// размер каждой — в байтах исходного файла, поэтому смещения записей точные в любой кодировке.
+type follower struct {
+	Lines chan charset.Line
+
+	file     *os.File
+	id       fileid.Identity // идентичность читаемого файла
+	gen      uint64          // поколение чтения, которым помечаются записи (см. models.FileGen)
+	splitter *charset.Splitter
+	start    int64
+	stop     chan struct{}
+	err      error
+}
+
+// newFollower начинает чтение открытого файла f с offset; при ошибке файл закрывается.
+// fallback — кодировка для файлов без BOM; BOM в начале файла имеет приоритет.
+func newFollower(f *os.File, id fileid.Identity, offset int64, fallback charset.Encoding) (*follower, error) {
+	if info, err := f.Stat(); err == nil && info.Size() < offset {
+		// файл короче сохранённого смещения — это уже другой файл, читаем сначала
+		offset = 0
+	}
+	enc := fallback
+	if offset > 0 {
+		head := make([]byte, 4)
+		n, _ := f.ReadAt(head, 0)
+		if sniffed, _, ok := charset.Sniff(head[:n]); ok {
+			enc = sniffed
+		}
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	fl := &follower{
+		Lines:    make(chan charset.Line),
+		file:     f,
+		id:       id,
+		splitter: charset.NewSplitter(enc, offset == 0),
+		start:    offset,
+		stop:     make(chan struct{}),
+	}
+	go fl.run()
+	return fl, nil
+}
+
+// Offset — смещение, с которого начато чтение (0, если сохранённое смещение оказалось за концом файла)
+func (f *follower) Offset() int64 {
+	return f.start
+}
+
+// Stop прекращает чтение; канал Lines закрывается
+func (f *follower) Stop() {
+	select {
+	case <-f.stop:
+	default:
+		close(f.stop)
+	}
+}
+
+// stopped сообщает, что чтение остановлено вызовом Stop
+func (f *follower) stopped() bool {
+	select {
+	case <-f.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// idleFor сообщает, что файл прочитан до позиции pos целиком и не менялся не меньше d
+func (f *follower) idleFor(pos int64, d time.Duration) bool {
+	info, err := f.file.Stat()
+	return err == nil && info.Size() == pos && time.Since(info.ModTime()) >= d
+}
+
+// Err возвращает причину завершения чтения после закрытия Lines (nil при Stop)
+func (f *follower) Err() error {
+	return f.err
+}
+
+func (f *follower) run() {
+	defer close(f.Lines)
+	defer f.file.Close()
+
+	buf := make([]byte, 64<<10)
+	read := f.start
+	for {
+		n, err := f.file.Read(buf)
+		if n > 0 {
+			read += int64(n)
+			f.splitter.Write(buf[:n])
+			for {
+				line, ok := f.splitter.Next()
+				if !ok {
+					break
+				}
+				select {
+				case f.Lines <- line:
+				case <-f.stop:
+					return
+				}
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if err != io.EOF {
+			f.err = err
+			return
+		}
+		if info, err := f.file.Stat(); err == nil && info.Size() < read {
+			f.err = errTruncated
+			return
+		}
+		select {
+		case <-f.stop:
+			return
+		case <-time.After(followPollInterval):
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package watcher
+
+import (
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// значения по умолчанию для ProcessedGC
+const (
+	defaultGCInterval    = time.Hour
+	defaultGCGracePeriod = 24 * time.Hour
+)
+
+// gcState — что очистка помнит о файлах между проходами
+type gcState struct {
+	missingSince map[string]time.Time // когда файл впервые не найден
+	lastSize     map[string]int64     // размер файла при последнем проходе, когда он ещё был
+}
+
+// runGC периодически удаляет состояние файлов, которые 1С уже удалила (см. collectGarbage)
+func (w *Watcher) runGC() {
+	w.mu.RLock()
+	cfg := w.cfg.Config.ProcessedGC
+	w.mu.RUnlock()
+	if cfg.Interval < 0 {
+		return
+	}
+	interval, grace := defaultGCInterval, defaultGCGracePeriod
+	if cfg.Interval > 0 {
+		interval = time.Duration(cfg.Interval) * time.Minute
+	}
+	if cfg.GracePeriod > 0 {
+		grace = time.Duration(cfg.GracePeriod) * time.Hour
+	}
+
+	st := gcState{missingSince: make(map[string]time.Time), lastSize: make(map[string]int64)}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		w.collectGarbage(&st, grace, time.Now())
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectGarbage удаляет состояние файлов, которых нет дольше grace и которые были дочитаны
+// до конца. Срок нужен, чтобы не потерять смещения при временной недоступности каталога
+// (например, сетевой папки). Файл, удалённый до запуска сервиса, считается дочитанным:
+// его размер неизвестен, и дочитать его уже нельзя.
+func (w *Watcher) collectGarbage(st *gcState, grace time.Duration, now time.Time) {
+	w.mu.RLock()
+	paths := make([]string, 0, len(w.processed))
+	for path := range w.processed {
+		if _, tailed := w.files[path]; !tailed {
+			paths = append(paths, path)
+		}
+	}
+	w.mu.RUnlock()
+
+	var drop []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		switch {
+		case err == nil:
+			delete(st.missingSince, path)
+			st.lastSize[path] = info.Size()
+		case os.IsNotExist(err):
+			since, ok := st.missingSince[path]
+			if !ok {
+				st.missingSince[path] = now
+			} else if now.Sub(since) >= grace {
+				drop = append(drop, path)
+			}
+		}
+		// прочие ошибки (нет доступа, сеть) — файл, возможно, на месте: состояние не трогаем
+	}
+
+	removed := 0
+	w.mu.Lock()
+	for _, path := range drop {
+		state, ok := w.processed[path]
+		if !ok {
+			continue
+		}
+		if size, seen := st.lastSize[path]; seen && state.Offset < size {
+			continue // файл удалён недочитанным: состояние нужно, если он вернётся
+		}
+		w.dropState(path)
+		delete(w.gens, path)
+		delete(w.inflight, path)
+		delete(w.waiters, path)
+		delete(st.missingSince, path)
+		delete(st.lastSize, path)
+		removed++
+	}
+	tracked := len(w.processed)
+	w.mu.Unlock()
+
+	// забываем файлы, состояние которых удалено иначе (переименование)
+	for path := range st.lastSize {
+		if !w.isTracked(path) {
+			delete(st.lastSize, path)
+			delete(st.missingSince, path)
+		}
+	}
+	if removed > 0 {
+		w.SaveProcessed()
+	}
+	w.cfg.Logger.Info("Очистка состояния файлов", zap.Int("removed", removed), zap.Int("tracked", tracked))
+}
+
+// isTracked сообщает, что для файла хранится состояние
+func (w *Watcher) isTracked(path string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	_, ok := w.processed[path]
+	return ok
+}
+
+// TrackedFiles возвращает число файлов, для которых хранится состояние
+func (w *Watcher) TrackedFiles() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.processed)
+}
@@ -0,0 +1,98 @@
+package watcher
+
+import (
+	"1CLogPumpClickHouse/internal/fileid"
+	"1CLogPumpClickHouse/internal/storage"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// sameFile сообщает, что сохранённое состояние относится к открытому файлу f с идентичностью id:
+// совпадают устройство, inode и отпечаток начала файла (inode удалённого файла может достаться новому)
+func sameFile(state storage.FileState, id fileid.Identity, f *os.File) bool {
+	if state.Dev != id.Dev || state.Inode != id.Inode {
+		return false
+	}
+	if state.FingerprintLen == 0 {
+		return true
+	}
+	fp, n, err := fileid.Fingerprint(f, state.FingerprintLen)
+	return err == nil && n == state.FingerprintLen && fp == state.Fingerprint
+}
+
+// identityAt возвращает идентичность файла, который сейчас лежит по пути path
+func identityAt(path string) (fileid.Identity, bool) {
+	f, err := openShared(path)
+	if err != nil {
+		return fileid.Identity{}, false
+	}
+	defer f.Close()
+	id, err := fileid.Of(f)
+	return id, err == nil && id.Known()
+}
+
+// modified сообщает, что файл path, который сейчас не читается, нужно открыть снова:
+// он дописан, усечён или по пути лежит уже другой файл (size — его текущий размер)
+func modified(path string, size int64, state storage.FileState) bool {
+	if size != state.Offset {
+		return true
+	}
+	if state.Inode == 0 {
+		return false
+	}
+	f, err := openShared(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	id, err := fileid.Of(f)
+	return err == nil && id.Known() && !sameFile(state, id, f)
+}
+
+// resolveOffset выбирает смещение для открытого файла f по пути path (вызывается под w.mu):
+// тот же файл — сохранённое смещение; файл переименован или перенесён из другого каталога —
+// смещение переносится со старого пути; по пути теперь другой файл — чтение с начала.
+// from — путь, состояние которого продолжается (пусто при чтении с начала); wait — старый путь
+// ещё читается или его записи не доставлены, чтение начнётся после этого (см. wake).
+func (w *Watcher) resolveOffset(path string, id fileid.Identity, f *os.File) (offset int64, from string, wait bool) {
+	state, known := w.processed[path]
+	// состояние без идентичности сохранено прежней версией или для файла, идентичность которого не определить
+	if known && (state.Inode == 0 || !id.Known() || sameFile(state, id, f)) {
+		return state.Offset, path, false
+	}
+	if id.Known() {
+		for old, st := range w.processed {
+			if old == path || !sameFile(st, id, f) {
+				continue
+			}
+			if cur, ok := identityAt(old); ok && cur == id {
+				continue // тот же файл доступен и по старому пути (жёсткая ссылка)
+			}
+			_, busy := w.inflight[old]
+			if t, ok := w.files[old]; ok || busy {
+				// смещение переносится, когда старое чтение завершится и его записи будут доставлены
+				if ok {
+					t.Stop()
+				}
+				w.addWaiter(old, path)
+				return 0, "", true
+			}
+			w.cfg.Logger.Info("Файл переименован, смещение перенесено",
+				zap.String("from", old), zap.String("file", path), zap.Int64("offset", st.Offset))
+			w.dropState(old)
+			return st.Offset, old, false
+		}
+	}
+	if known {
+		w.cfg.Logger.Warn("По пути теперь другой файл, читаем сначала",
+			zap.String("file", path), zap.Int64("offset", state.Offset))
+	}
+	return 0, "", false
+}
+
+// replaced сообщает, что по пути path лежит уже не тот файл, который читает t
+func replaced(path string, t *follower) bool {
+	id, ok := identityAt(path)
+	return ok && t.id.Known() && id != t.id
+}
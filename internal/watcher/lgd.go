@@ -0,0 +1,90 @@
+package watcher
+
+import (
+	"1CLogPumpClickHouse/internal/eventlog"
+	"1CLogPumpClickHouse/internal/models"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// lgdReadLimit — сколько записей 1Cv8.lgd читать за один запрос
+const lgdReadLimit = 1000
+
+// startLgdPollers запускает опрос журналов регистрации в формате SQLite (1Cv8.lgd)
+// для каталогов EventLogDirectoryMap, в которых такой файл есть
+func (w *Watcher) startLgdPollers() {
+	for infoBase, dir := range w.cfg.Config.EventLogDirectoryMap {
+		path := filepath.Join(dir, "1Cv8.lgd")
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		go w.pollLgd(infoBase, path)
+	}
+}
+
+// pollLgd периодически дочитывает новые строки таблицы EventLog по rowID.
+// Последний вставленный в ClickHouse rowID хранится в processed под путём к 1Cv8.lgd.
+func (w *Watcher) pollLgd(infoBase, path string) {
+	reader, err := eventlog.OpenSQLite(path, w.times.Location())
+	if err != nil {
+		w.cfg.Logger.Error("Не удалось открыть журнал регистрации", zap.String("file", path), zap.Error(err))
+		return
+	}
+	defer reader.Close()
+	w.cfg.Logger.Info("Запущен опрос журнала регистрации", zap.String("file", path))
+
+	interval := time.Duration(w.cfg.Config.EventLogPollInterval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// состояние заводится здесь: Commit только сдвигает смещения уже известных файлов
+	w.mu.Lock()
+	state, known := w.processed[path]
+	gen, ok := w.gens[path]
+	if !ok {
+		gen = w.newGen(path)
+	}
+	if !known || state.Gen != gen {
+		state.Gen = gen
+		w.setState(path, state)
+	}
+	lastRowID := state.Offset
+	w.mu.Unlock()
+	w.SaveProcessed()
+
+	for {
+		records, rowIDs, err := reader.ReadAfter(w.ctx, lastRowID, lgdReadLimit)
+		if err != nil {
+			w.cfg.Logger.Error("Ошибка чтения журнала регистрации", zap.String("file", path), zap.Error(err))
+		}
+		for i := range records {
+			records[i].InfoBase = infoBase
+			w.batchCh <- models.LogEntry{
+				Timestamp: filepath.Base(path),
+				File:      path,
+				Offset:    rowIDs[i],
+				End:       rowIDs[i],
+				Gen:       gen,
+				EventTime: records[i].EventTime,
+				EventLog:  &records[i],
+			}
+			lastRowID = rowIDs[i]
+		}
+		if len(records) == lgdReadLimit && w.ctx.Err() == nil {
+			// есть ещё записи — читаем сразу, не дожидаясь тика
+			continue
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package watcher
+
+import "os"
+
+// openShared открывает файл только для чтения
+func openShared(path string) (*os.File, error) {
+	return os.Open(path)
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package watcher
+
+import (
+	"os"
+	"syscall"
+)
+
+// openShared открывает файл только для чтения, не мешая 1С удалять и переименовывать его
+// (os.Open на Windows не передаёт FILE_SHARE_DELETE, и старые логи нельзя было бы удалить)
+func openShared(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
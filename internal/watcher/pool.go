@@ -0,0 +1,85 @@
+package watcher
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// значения по умолчанию для Tail
+const (
+	defaultMaxOpenFiles = 256
+	defaultIdleTimeout  = 10 * time.Minute
+)
+
+// idleCheckInterval — как часто readTail проверяет, что файл дочитан и не меняется
+const idleCheckInterval = 5 * time.Second
+
+// maxOpenFiles возвращает предел одновременно читаемых файлов; 0 — без ограничения (вызывается под w.mu)
+func (w *Watcher) maxOpenFiles() int {
+	switch n := w.cfg.Config.Tail.MaxOpenFiles; {
+	case n < 0:
+		return 0
+	case n == 0:
+		return defaultMaxOpenFiles
+	default:
+		return n
+	}
+}
+
+// idleTimeout возвращает, через сколько без изменений дочитанный файл закрывается; 0 — не закрывать
+func (w *Watcher) idleTimeout() time.Duration {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	switch n := w.cfg.Config.Tail.IdleTimeout; {
+	case n < 0:
+		return 0
+	case n == 0:
+		return defaultIdleTimeout
+	default:
+		return time.Duration(n) * time.Minute
+	}
+}
+
+// enqueue ставит файл в очередь на чтение, когда все места в пуле заняты (вызывается под w.mu)
+func (w *Watcher) enqueue(path string) {
+	if _, ok := w.queued[path]; ok {
+		return
+	}
+	w.queued[path] = struct{}{}
+	w.pending = append(w.pending, path)
+	w.cfg.Logger.Debug("Пул чтения заполнен, файл ждёт очереди",
+		zap.String("file", path), zap.Int("queued", len(w.pending)))
+}
+
+// startPending открывает файлы из очереди, пока в пуле есть места (вызывается под w.mu)
+func (w *Watcher) startPending() {
+	for len(w.pending) > 0 {
+		if limit := w.maxOpenFiles(); limit > 0 && len(w.files) >= limit {
+			return
+		}
+		path := w.pending[0]
+		w.pending = w.pending[1:]
+		delete(w.queued, path)
+		w.startTailLocked(path)
+	}
+}
+
+// closeIdle закрывает дочитанный файл, если все его записи до lastEnd доставлены.
+// Строки между lastEnd и pos записей не содержат (пустые строки, заголовок), поэтому
+// смещение сдвигается до pos: иначе файл тут же открылся бы снова ради них.
+func (w *Watcher) closeIdle(path string, t *follower, lastEnd, pos int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	state, ok := w.processed[path]
+	if !ok || state.Offset < lastEnd || w.files[path] != t {
+		return false
+	}
+	if pos > state.Offset {
+		state.Offset = pos
+		w.setState(path, state)
+	}
+	t.Stop()
+	w.cfg.Logger.Debug("Файл дочитан и не меняется, закрыт", zap.String("file", path), zap.Int64("offset", pos))
+	return true
+}
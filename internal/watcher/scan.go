@@ -6,20 +6,10 @@ import (
 	"go.uber.org/zap"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
-	"strings"
 	"time"
 )
 
-// --- Добавим регулярное выражение для определения начала новой лог-записи ---
-var logRecordRegex = regexp.MustCompile(`\d{2}:\d{2}\.\d{2,}.*-.*`)
-
-// isNewLogRecord определяет начало новой записи по регулярному выражению
-func isNewLogRecord(s string) bool {
-	return logRecordRegex.MatchString(s)
-}
-
 // watchConfig следит за изменениями config.yaml
 func (w *Watcher) watchConfig() {
 	watcher, err := fsnotify.NewWatcher()
@@ -53,17 +43,6 @@ func (w *Watcher) watchConfig() {
 
 // handleDirEvents обрабатывает fsnotify события в папках
 func (w *Watcher) handleDirEvents(dw *fsnotify.Watcher) {
-	// Компилируем шаблон имен файлов один раз
-	patternStr := w.cfg.Config.FilePattern
-	patternStr = strings.ReplaceAll(patternStr, ".", `\.`)
-	patternStr = strings.ReplaceAll(patternStr, "*", ".*")
-	patternStr = strings.ReplaceAll(patternStr, "?", ".")
-	filePattern, err := regexp.Compile("^" + patternStr + "$")
-	if err != nil {
-		w.cfg.Logger.Error("Неверный FilePattern в конфиге", zap.String("pattern", w.cfg.Config.FilePattern), zap.Error(err))
-		// Если шаблон сломан, пропускаем сканирование файлов
-	}
-
 	for {
 		select {
 		case <-w.ctx.Done():
@@ -79,7 +58,7 @@ func (w *Watcher) handleDirEvents(dw *fsnotify.Watcher) {
 						if i.IsDir() {
 							dw.Add(p)
 							w.cfg.Logger.Info("Добавлен watcher для директории", zap.String("dir", p))
-						} else if filePattern != nil && filePattern.MatchString(filepath.Base(p)) {
+						} else if w.isLogFile(p) {
 							w.cfg.Logger.Info("Найден файл в новой папке, запускаем tail", zap.String("file", p))
 							w.startTail(p)
 						}
@@ -88,20 +67,24 @@ func (w *Watcher) handleDirEvents(dw *fsnotify.Watcher) {
 				}
 				continue
 			}
-			if filepath.Ext(ev.Name) == ".log" {
-				if ev.Op&(fsnotify.Create|fsnotify.Rename) != 0 {
+			if w.isLogFile(ev.Name) {
+				if ev.Op&fsnotify.Create != 0 {
+					// в том числе новое имя переименованного файла: смещение переносится по идентичности
 					w.startTail(ev.Name)
 				}
 				if ev.Op&fsnotify.Write != 0 {
 					// проверяем, добавились ли новые данные
 					info, err := os.Stat(ev.Name)
 					if err == nil {
-						if offset, ok := w.processed[ev.Name]; ok && info.Size() > offset {
+						w.mu.RLock()
+						state, ok := w.processed[ev.Name]
+						w.mu.RUnlock()
+						if ok && modified(ev.Name, info.Size(), state) {
 							w.startTail(ev.Name)
 						}
 					}
 				}
-				if ev.Op&fsnotify.Remove != 0 {
+				if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
 					w.stopTail(ev.Name)
 				}
 			}
@@ -111,30 +94,22 @@ func (w *Watcher) handleDirEvents(dw *fsnotify.Watcher) {
 	}
 }
 
-// scanInitialFiles: если processed пуст — первый запуск, сканируем все файлы; иначе — только последний
+// ScanInitialFiles открывает файлы каталога в порядке времени изменения: при первом запуске
+// (processed пуст) и для неизвестных файлов — все подходящие; для известных — только те,
+// что не читаются сейчас и были дописаны, усечены или заменены другим файлом
 func (w *Watcher) ScanInitialFiles() {
-	patternStr := w.cfg.Config.FilePattern
-	patternStr = strings.ReplaceAll(patternStr, ".", `\.`)
-	patternStr = strings.ReplaceAll(patternStr, "*", ".*")
-	patternStr = strings.ReplaceAll(patternStr, "?", ".")
-	pattern, err := regexp.Compile("^" + patternStr + "$")
-	if err != nil {
-		w.cfg.Logger.Error("Неверный FilePattern", zap.String("pattern", w.cfg.Config.FilePattern), zap.Error(err))
-		return
-	}
-
 	w.mu.RLock()
 	firstRun := len(w.processed) == 0
 	w.mu.RUnlock()
 
-	for _, dir := range w.cfg.Config.LogDirectoryMap {
+	for _, dir := range w.logDirs() {
 		var files []os.FileInfo
 		var paths []string
 		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 			if err != nil || info.IsDir() {
 				return nil
 			}
-			if pattern.MatchString(filepath.Base(path)) {
+			if w.isLogFile(path) {
 				files = append(files, info)
 				paths = append(paths, path)
 			}
@@ -143,21 +118,28 @@ func (w *Watcher) ScanInitialFiles() {
 		type fileWithTime struct {
 			Path string
 			Mod  time.Time
+			Size int64
 		}
 		var sorted []fileWithTime
 		for i, fi := range files {
-			sorted = append(sorted, fileWithTime{Path: paths[i], Mod: fi.ModTime()})
+			sorted = append(sorted, fileWithTime{Path: paths[i], Mod: fi.ModTime(), Size: fi.Size()})
 		}
 		sort.Slice(sorted, func(i, j int) bool {
 			return sorted[i].Mod.Before(sorted[j].Mod)
 		})
 		for _, f := range sorted {
 			w.mu.RLock()
-			_, already := w.processed[f.Path]
+			state, already := w.processed[f.Path]
+			_, reading := w.files[f.Path]
 			w.mu.RUnlock()
 			if !already || firstRun {
 				w.cfg.Logger.Info("Запускаем tail для", zap.String("file", f.Path))
 				w.startTail(f.Path)
+			} else if !reading && modified(f.Path, f.Size, state) {
+				// файл закрыт пулом чтения или чтение прервалось, а файл дописан, усечён
+				// или заменён (в том числе пока сервис был остановлен) — событие могло быть пропущено
+				w.cfg.Logger.Debug("Файл изменился, открываем снова", zap.String("file", f.Path))
+				w.startTail(f.Path)
 			} else {
 				w.cfg.Logger.Debug("Пропускаем ранее обработанный файл", zap.String("file", f.Path))
 			}
@@ -0,0 +1,153 @@
+package watcher
+
+import (
+	"1CLogPumpClickHouse/internal/config"
+	"1CLogPumpClickHouse/internal/eventlog"
+	"1CLogPumpClickHouse/internal/models"
+	"1CLogPumpClickHouse/internal/parser"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// recordDecoder разбирает собранную запись в LogEntry
+type recordDecoder func(record parser.Record) (models.LogEntry, error)
+
+// sourceFor выбирает сборщик и декодер записей по виду файла и настройкам каталога
+func (w *Watcher) sourceFor(path string, offset int64) (parser.Assembler, recordDecoder) {
+	p := w.parserFor(path)
+	decode := func(record parser.Record) (models.LogEntry, error) {
+		entry, err := p.Parse(record)
+		if err == nil && entry.EventTime.IsZero() && entry.LogTimestamp != "" {
+			// в техжурнале только минуты и секунды: час берём из имени файла
+			entry.EventTime, err = w.times.Resolve(path, entry.LogTimestamp)
+		}
+		return entry, err
+	}
+	return p.NewAssembler(offset), decode
+}
+
+// parserFor возвращает парсер файла: журнал регистрации для .lgp из EventLogDirectoryMap,
+// иначе — формат из Parsers по ключу LogDirectoryMap (по умолчанию техжурнал)
+func (w *Watcher) parserFor(path string) parser.Parser {
+	if infoBase, ok := w.eventLogInfoBase(path); ok {
+		return &eventlog.Parser{
+			InfoBase: infoBase,
+			Dict:     w.dictionaryFor(filepath.Dir(path)),
+			Location: w.times.Location(),
+		}
+	}
+
+	w.mu.RLock()
+	var pc config.ParserConfig
+	for key, dir := range w.cfg.Config.LogDirectoryMap {
+		if inDir(dir, path) {
+			pc = w.cfg.Config.Parsers[key]
+			break
+		}
+	}
+	w.mu.RUnlock()
+
+	opts := parser.FieldOptions{
+		Event:      pc.Event,
+		TimeLayout: pc.TimeLayout,
+		Location:   w.times.Location(),
+		Fields:     pc.Fields,
+	}
+	switch pc.Type {
+	case "jsonl":
+		return parser.NewJSONParser(opts)
+	case "regex":
+		p, err := parser.NewRegexParser(pc.Pattern, opts)
+		if err == nil {
+			return p
+		}
+		w.cfg.Logger.Error("Неверный Pattern парсера, файл читается как техжурнал", zap.String("file", path), zap.Error(err))
+	}
+	return parser.TechLog
+}
+
+// inDir сообщает, лежит ли файл внутри каталога dir (на любой глубине)
+func inDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
+
+// eventLogInfoBase возвращает ключ EventLogDirectoryMap для файла журнала регистрации (.lgp)
+func (w *Watcher) eventLogInfoBase(path string) (string, bool) {
+	if !strings.EqualFold(filepath.Ext(path), ".lgp") {
+		return "", false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for key, dir := range w.cfg.Config.EventLogDirectoryMap {
+		if inDir(dir, path) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// isEventLogFile сообщает, относится ли файл к журналу регистрации из EventLogDirectoryMap
+func (w *Watcher) isEventLogFile(path string) bool {
+	_, ok := w.eventLogInfoBase(path)
+	return ok
+}
+
+// dictionaryFor возвращает словарь 1Cv8.lgf каталога журнала регистрации, загружая его при первом обращении
+func (w *Watcher) dictionaryFor(dir string) *eventlog.Dictionary {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if d, ok := w.dictionaries[dir]; ok {
+		return d
+	}
+	d := eventlog.NewDictionary(filepath.Join(dir, "1Cv8.lgf"))
+	if err := d.Load(); err != nil {
+		w.cfg.Logger.Error("Не удалось загрузить словарь журнала регистрации", zap.String("dir", dir), zap.Error(err))
+	}
+	w.dictionaries[dir] = d
+	return d
+}
+
+// isLogFile сообщает, является ли файл логом, который нужно читать: .lgp журнала регистрации
+// или файл каталога LogDirectoryMap, имя которого подходит под FilePattern из Parsers
+// (для jsonl и regex это, например, *.jsonl) или под общий FilePattern
+func (w *Watcher) isLogFile(path string) bool {
+	if w.isEventLogFile(path) {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	glob, ok := "", false
+	for key, dir := range w.cfg.Config.LogDirectoryMap {
+		if inDir(dir, path) {
+			glob, ok = w.cfg.Config.Parsers[key].FilePattern, true
+			break
+		}
+	}
+	if !ok {
+		return false
+	}
+	if glob == "" {
+		glob = w.cfg.Config.FilePattern
+	}
+	re, cached := w.patterns[glob]
+	if !cached {
+		var err error
+		if re, err = globRegexp(glob); err != nil {
+			w.cfg.Logger.Error("Неверный шаблон имён файлов", zap.String("pattern", glob), zap.Error(err))
+		}
+		w.patterns[glob] = re
+	}
+	return re != nil && re.MatchString(filepath.Base(path))
+}
+
+// globRegexp переводит шаблон имён файлов (* и ?) в регулярное выражение
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	s := strings.ReplaceAll(glob, ".", `\.`)
+	s = strings.ReplaceAll(s, "*", ".*")
+	s = strings.ReplaceAll(s, "?", ".")
+	return regexp.Compile("^" + s + "$")
+}
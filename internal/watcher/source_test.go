@@ -0,0 +1,46 @@
+package watcher
+
+import (
+	"1CLogPumpClickHouse/internal/config"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestIsLogFile(t *testing.T) {
+	root := t.TempDir()
+	techlog := filepath.Join(root, "techlog")
+	jsonl := filepath.Join(root, "app")
+	eventlog := filepath.Join(root, "1Cv8Log")
+	w := &Watcher{
+		cfg: Config{
+			Logger: zap.NewNop(),
+			Config: &config.Config{
+				LogDirectoryMap:      map[string]string{"TL": techlog, "App": jsonl},
+				EventLogDirectoryMap: map[string]string{"Buh": eventlog},
+				Parsers:              map[string]config.ParserConfig{"App": {Type: "jsonl", FilePattern: "*.jsonl"}},
+				FilePattern:          "*.log",
+			},
+		},
+		patterns: make(map[string]*regexp.Regexp),
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(techlog, "rphost_123", "25052607.log"), true},
+		{filepath.Join(techlog, "rphost_123", "25052607.txt"), false},
+		{filepath.Join(jsonl, "events-2025.jsonl"), true},
+		{filepath.Join(jsonl, "events.log"), false},
+		{filepath.Join(eventlog, "20250526000000.lgp"), true},
+		{filepath.Join(eventlog, "1Cv8.lgf"), false},
+		{filepath.Join(root, "other", "25052607.log"), false},
+	}
+	for _, tt := range tests {
+		if got := w.isLogFile(tt.path); got != tt.want {
+			t.Errorf("isLogFile(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -1,116 +1,263 @@
 package watcher
 
 import (
+	"1CLogPumpClickHouse/internal/charset"
+	"1CLogPumpClickHouse/internal/fileid"
 	"1CLogPumpClickHouse/internal/parser"
-	"io"
+	"1CLogPumpClickHouse/internal/storage"
+	"errors"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/hpcloud/tail"
 	"go.uber.org/zap"
 )
 
-// startTail запускает tail для файла, начиная с сохранённого смещения
+// inflight — конец последней записи, отданной остановленным чтением файла (в поколении gen).
+// Пока записи до end не зафиксированы, файл не открывается снова: иначе чтение
+// с зафиксированного смещения отправило бы их второй раз.
+type inflight struct {
+	gen uint64
+	end int64
+}
+
+// addWaiter откладывает запуск чтения path до доставки записей файла busy (вызывается под w.mu)
+func (w *Watcher) addWaiter(busy, path string) {
+	for _, p := range w.waiters[busy] {
+		if p == path {
+			return
+		}
+	}
+	w.waiters[busy] = append(w.waiters[busy], path)
+	w.cfg.Logger.Debug("Чтение отложено до доставки прочитанных записей",
+		zap.String("file", path), zap.String("busy", busy))
+}
+
+// wake запускает чтение файлов, ждавших доставки записей path (вызывается под w.mu)
+func (w *Watcher) wake(path string) {
+	waiters := w.waiters[path]
+	delete(w.waiters, path)
+	for _, p := range waiters {
+		w.startTailLocked(p)
+	}
+}
+
+// startTail запускает чтение файла, начиная с сохранённого смещения.
+// Смещение применяется, только если по пути тот же файл (см. resolveOffset).
+// Если пул чтения заполнен, файл ждёт в очереди, пока не закроется другой.
 func (w *Watcher) startTail(path string) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	if _, exists := w.files[path]; exists {
+	w.startTailLocked(path)
+}
+
+// startTailLocked — startTail под уже захваченным w.mu
+func (w *Watcher) startTailLocked(path string) {
+	if t, exists := w.files[path]; exists {
+		if t.stopped() {
+			// прежнее чтение ещё завершается и отдаёт последнюю запись
+			w.addWaiter(path, path)
+			return
+		}
+		if !replaced(path, t) {
+			return
+		}
+		w.cfg.Logger.Info("Файл заменён новым с тем же именем", zap.String("file", path))
+		t.Stop()
+		delete(w.files, path)
+	}
+	if _, busy := w.inflight[path]; busy {
+		w.addWaiter(path, path)
+		return
+	}
+	if limit := w.maxOpenFiles(); limit > 0 && len(w.files) >= limit {
+		w.enqueue(path)
+		return
+	}
+	enc, err := charset.Lookup(w.cfg.Config.Encoding)
+	if err != nil {
+		w.cfg.Logger.Error("Неверная кодировка Encoding, используется UTF-8", zap.Error(err))
+		enc = charset.UTF8
+	}
+	f, err := openShared(path)
+	if err != nil {
+		w.cfg.Logger.Error("Ошибка открытия файла для чтения", zap.String("file", path), zap.Error(err))
+		return
+	}
+	id, err := fileid.Of(f)
+	if err != nil {
+		w.cfg.Logger.Warn("Не удалось определить идентичность файла", zap.String("file", path), zap.Error(err))
+	}
+	offset, from, wait := w.resolveOffset(path, id, f)
+	if wait {
+		f.Close()
 		return
 	}
-	var loc tail.SeekInfo
-	if offset, ok := w.processed[path]; ok {
-		loc = tail.SeekInfo{Offset: offset, Whence: io.SeekStart}
-	} else {
-		loc = tail.SeekInfo{Offset: 0, Whence: io.SeekStart}
+	fp, fpLen, err := fileid.Fingerprint(f, fileid.FingerprintSize)
+	if err != nil {
+		w.cfg.Logger.Warn("Не удалось прочитать начало файла", zap.String("file", path), zap.Error(err))
 	}
-	t, err := tail.TailFile(path, tail.Config{Follow: true, ReOpen: true, MustExist: false, Location: &loc, Logger: tail.DiscardingLogger})
+	t, err := newFollower(f, id, offset, enc)
 	if err != nil {
-		w.cfg.Logger.Error("Ошибка открытия tail", zap.String("file", path), zap.Error(err))
+		w.cfg.Logger.Error("Ошибка открытия файла для чтения", zap.String("file", path), zap.Error(err))
 		return
 	}
+	if t.Offset() != offset {
+		w.cfg.Logger.Warn("Файл короче сохранённого смещения, читаем сначала",
+			zap.String("file", path), zap.Int64("offset", offset))
+	}
+	// поколение продолжается, только если продолжается чтение того же файла;
+	// переименованный файл уносит поколение со старого пути
+	gen, ok := w.gens[from]
+	delete(w.gens, from)
+	if from == "" || !ok || t.Offset() != offset {
+		gen = w.newGen(path)
+	}
+	w.gens[path] = gen
+	t.gen = gen
+	w.setState(path, storage.FileState{
+		Offset:         t.Offset(),
+		Dev:            id.Dev,
+		Inode:          id.Inode,
+		Fingerprint:    fp,
+		FingerprintLen: fpLen,
+		Gen:            gen,
+	})
 	w.files[path] = t
 	w.cfg.Logger.Info("Запущен tail для файла", zap.String("file", path))
 	go w.readTail(path, t)
 }
 
-// stopTail останавливает tail и сохраняет processed
+// stopTail останавливает tail и сохраняет processed; место в пуле освобождается,
+// когда readTail отдаст последнюю запись и завершится
 func (w *Watcher) stopTail(path string) {
 	w.mu.Lock()
-	defer w.mu.Unlock()
-	if t, ok := w.files[path]; ok {
+	t, ok := w.files[path]
+	if ok {
 		t.Stop()
-		delete(w.files, path)
-		if err := w.store.Save(w.processed); err != nil {
-			w.cfg.Logger.Error("Не удалось сохранить processed_files", zap.Error(err))
-		}
+	}
+	w.mu.Unlock()
+	if ok {
+		w.SaveProcessed()
 	}
 }
 
-// readTail читает строки, парсит записи и обновляет offset
-func (w *Watcher) readTail(path string, t *tail.Tail) {
+// readTail читает строки, собирает из них записи, парсит и обновляет offset
+func (w *Watcher) readTail(path string, t *follower) {
 	defer func() {
 		if r := recover(); r != nil {
 			w.cfg.Logger.Error("Паника в readTail восстановлена", zap.Any("error", r))
 		}
 	}()
-	var buffer []string
-	var timer *time.Timer
-
-	resetTimer := func() {
-		if timer != nil {
-			timer.Stop()
+	restart := false
+	// lastEnd — конец последней отданной записи
+	lastEnd := t.Offset()
+	defer func() {
+		// чтение завершилось само (ошибка, файл закрыт как неактивный) — следующее событие
+		// или периодическое сканирование запустит его заново; место в пуле отдаётся очереди
+		w.mu.Lock()
+		if w.files[path] == t {
+			delete(w.files, path)
 		}
-		timer = time.NewTimer(2 * time.Second)
-	}
-
-	flushBuffer := func() {
-		if len(buffer) == 0 {
-			return
+		switch {
+		case w.gens[path] != t.gen:
+			// по пути уже читается другой файл
+		case restart:
+			// усечённый файл читается сначала в новом поколении: ещё не доставленные
+			// записи прежнего содержимого не сдвинут смещение нового
+			gen := w.newGen(path)
+			if state, ok := w.processed[path]; ok {
+				state.Offset, state.Gen = 0, gen
+				w.setState(path, state)
+			}
+			delete(w.inflight, path)
+		case lastEnd > w.processed[path].Offset:
+			w.inflight[path] = inflight{gen: t.gen, end: lastEnd}
 		}
-		entry, err := parser.ParseLine(buffer)
-		if err != nil {
-			w.cfg.Logger.Warn("Ошибка парсинга лога", zap.String("file", path), zap.Error(err))
-			buffer = buffer[:0]
-			return
+		if _, busy := w.inflight[path]; !busy {
+			w.wake(path)
 		}
+		w.startPending()
+		w.mu.Unlock()
+		if restart {
+			w.startTail(path)
+		}
+	}()
+	// поколение сохраняется до первой записи: иначе после сбоя между вставкой и фиксацией
+	// файл перечитался бы в новом поколении, и ClickHouse не узнал бы повтор по токену
+	w.SaveProcessed()
+	assembler, decode := w.sourceFor(path, t.Offset())
+	// pos — позиция после последней прочитанной строки
+	pos := t.Offset()
+	lastLine := time.Now()
+	draining := false
+	idle := time.NewTicker(idleCheckInterval)
+	defer idle.Stop()
+
+	emit := func(record parser.Record) {
+		entry, err := decode(record)
 		entry.Timestamp = filepath.Base(path)
-		w.batchCh <- entry
-		off, err := t.Tell()
-		if err == nil {
-			w.mu.Lock()
-			w.processed[path] = off
-			w.mu.Unlock()
+		entry.File = path
+		entry.Offset = record.Offset
+		entry.Raw = record.Text
+		if err != nil {
+			// запись не теряется: её примет карантин на стороне ClickHouse-клиента
+			w.cfg.Logger.Warn("Ошибка парсинга лога, запись уходит в карантин",
+				zap.String("file", path), zap.Int64("offset", record.Offset), zap.Error(err))
+			entry.ParseError = err.Error()
 		}
-		buffer = buffer[:0]
+		// смещение фиксируется не здесь, а после вставки batch-а (см. Commit)
+		entry.End = record.End
+		entry.Gen = t.gen
+		lastEnd = record.End
+		w.batchCh <- entry
 	}
 
 	for {
 		select {
 		case <-w.ctx.Done():
-			flushBuffer()
+			t.Stop()
 			return
 		case line, ok := <-t.Lines:
 			if !ok {
-				flushBuffer()
+				if err := t.Err(); err != nil {
+					w.cfg.Logger.Warn("Чтение файла прервано", zap.String("file", path), zap.Error(err))
+					// усечённый файл перечитывается сначала сразу, не дожидаясь событий
+					restart = errors.Is(err, errTruncated)
+				}
+				if record, ok := assembler.Flush(); ok {
+					emit(record)
+				}
 				return
 			}
-			clean := strings.ReplaceAll(line.Text, "\x00", "")
-			if strings.Contains(line.Text, "\x00") {
+			pos += line.Size
+			lastLine = time.Now()
+			draining = false
+			text := line.Text
+			if strings.Contains(text, "\x00") {
+				// после декодирования нулевых байт быть не должно: файл повреждён или кодировка указана неверно
 				w.cfg.Logger.Warn("Обнаружены нулевые байты в строке", zap.String("file", path))
+				text = strings.ReplaceAll(text, "\x00", "")
 			}
-			if isNewLogRecord(clean) {
-				flushBuffer()
+			for _, record := range assembler.Push(text, line.Size) {
+				emit(record)
 			}
-			buffer = append(buffer, clean)
-			resetTimer()
-		case <-func() <-chan time.Time {
-			if timer != nil {
-				return timer.C
+		case <-idle.C:
+			timeout := w.idleTimeout()
+			if timeout <= 0 || time.Since(lastLine) < idleCheckInterval || !t.idleFor(pos, timeout) {
+				continue
+			}
+			if !draining {
+				// файл дочитан и давно не менялся: последняя запись уже завершена,
+				// отдаём её и закрываем файл, когда она будет доставлена
+				if record, ok := assembler.Flush(); ok {
+					emit(record)
+				}
+				draining = true
+			}
+			if w.closeIdle(path, t, lastEnd, pos) {
+				return
 			}
-			return make(chan time.Time)
-		}():
-			flushBuffer()
 		}
 	}
 }
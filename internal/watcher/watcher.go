@@ -2,16 +2,18 @@ package watcher
 
 import (
 	"1CLogPumpClickHouse/internal/config"
+	"1CLogPumpClickHouse/internal/eventlog"
 	"1CLogPumpClickHouse/internal/models"
 	"1CLogPumpClickHouse/internal/storage"
+	"1CLogPumpClickHouse/internal/transform"
 	"context"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
-	"github.com/hpcloud/tail"
 	"go.uber.org/zap"
 )
 
@@ -23,31 +25,67 @@ type Config struct {
 }
 
 type Watcher struct {
-	cfg         Config
-	store       storage.ProcessedStore
-	batchCh     chan<- models.LogEntry
-	files       map[string]*tail.Tail
-	processed   map[string]int64
-	mu          sync.RWMutex
-	ctx         context.Context
-	dirWatcher  *fsnotify.Watcher
-	watchedDirs map[string]struct{} // Отслеживаемые директории
+	cfg          Config
+	store        storage.ProcessedStore
+	batchCh      chan<- models.LogEntry
+	files        map[string]*follower
+	pending      []string            // файлы, ждущие свободного места в пуле чтения (Tail.MaxOpenFiles)
+	queued       map[string]struct{} // те же файлы для проверки повторной постановки
+	processed    map[string]storage.FileState
+	dirty        map[string]struct{} // файлы, состояние которых изменилось или удалено после сохранения
+	saveMu       sync.Mutex          // сохранения идут по одному: более старое не перезапишет более новое
+	gens         map[string]uint64   // текущее поколение чтения файла (см. models.FileGen)
+	lastGen      uint64
+	inflight     map[string]inflight // файлы, чтение которых остановлено раньше доставки прочитанных записей
+	waiters      map[string][]string // файлы, которые начнут читаться после доставки записей ключевого файла
+	mu           sync.RWMutex
+	ctx          context.Context
+	dirWatcher   *fsnotify.Watcher
+	watchedDirs  map[string]struct{} // Отслеживаемые директории
+	times        *transform.TimeResolver
+	dictionaries map[string]*eventlog.Dictionary // Словари журналов регистрации по каталогам
+	patterns     map[string]*regexp.Regexp       // Скомпилированные шаблоны имён файлов (nil — неверный шаблон)
 }
 
 func New(cfg Config, batchCh chan models.LogEntry) *Watcher {
 	processed, err := cfg.Store.Load()
 	if err != nil {
 		cfg.Logger.Error("Не удалось загрузить processed_files", zap.Error(err))
-		processed = make(map[string]int64)
+		processed = make(map[string]storage.FileState)
+	}
+	times, err := transform.NewTimeResolver(cfg.Config.TimeZone)
+	if err != nil {
+		cfg.Logger.Error("Неверный TimeZone, используется локальный часовой пояс", zap.Error(err))
+		times, _ = transform.NewTimeResolver("")
+	}
+
+	// поколения сохраняются вместе со смещениями: записи, перечитанные после перезапуска,
+	// получают тот же токен дедупликации, что и до него
+	gens := make(map[string]uint64)
+	var lastGen uint64
+	for path, state := range processed {
+		if state.Gen != 0 {
+			gens[path] = state.Gen
+			lastGen = max(lastGen, state.Gen)
+		}
 	}
 
 	return &Watcher{
-		cfg:         cfg,
-		store:       cfg.Store,
-		batchCh:     batchCh,
-		files:       make(map[string]*tail.Tail),
-		processed:   processed,
-		watchedDirs: make(map[string]struct{}),
+		cfg:          cfg,
+		store:        cfg.Store,
+		batchCh:      batchCh,
+		files:        make(map[string]*follower),
+		queued:       make(map[string]struct{}),
+		processed:    processed,
+		dirty:        make(map[string]struct{}),
+		gens:         gens,
+		lastGen:      lastGen,
+		inflight:     make(map[string]inflight),
+		waiters:      make(map[string][]string),
+		watchedDirs:  make(map[string]struct{}),
+		times:        times,
+		dictionaries: make(map[string]*eventlog.Dictionary),
+		patterns:     make(map[string]*regexp.Regexp),
 	}
 }
 
@@ -74,6 +112,105 @@ func (w *Watcher) addWatchers(dir string, dw *fsnotify.Watcher) error {
 	})
 }
 
+// logDirs возвращает все каталоги логов: техжурнала и журналов регистрации
+func (w *Watcher) logDirs() []string {
+	dirs := make([]string, 0, len(w.cfg.Config.LogDirectoryMap)+len(w.cfg.Config.EventLogDirectoryMap))
+	for _, dir := range w.cfg.Config.LogDirectoryMap {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range w.cfg.Config.EventLogDirectoryMap {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// Commit фиксирует смещения, до которых записи файлов вставлены в ClickHouse
+// (или надёжно записаны в спул). В ProcessedStore попадают только такие смещения,
+// поэтому после падения файл дочитывается с первой неотправленной записи.
+// Смещения прежнего поколения файла (заменён, усечён, переименован) отбрасываются,
+// и состояние из фиксации не создаётся: его заводит только startTail.
+// Смещения сохраняются сразу, а не по таймеру: после падения файл не перечитывается
+// с давно сохранённого смещения, и уже вставленные записи не вставляются второй раз.
+func (w *Watcher) Commit(offsets map[models.FileGen]int64) {
+	w.mu.Lock()
+	changed := false
+	for fg, off := range offsets {
+		state, ok := w.processed[fg.File]
+		if !ok || w.gens[fg.File] != fg.Gen {
+			continue
+		}
+		if off > state.Offset {
+			state.Offset = off
+			w.setState(fg.File, state)
+			changed = true
+		}
+		if p, ok := w.inflight[fg.File]; ok && p.gen == fg.Gen && state.Offset >= p.end {
+			// все прочитанные записи доставлены: файл можно читать снова
+			delete(w.inflight, fg.File)
+			w.wake(fg.File)
+		}
+	}
+	w.mu.Unlock()
+	if changed {
+		w.SaveProcessed()
+	}
+}
+
+// newGen выдаёт новое поколение чтения файла path (вызывается под w.mu).
+// Поколения растут и между запусками: номер не достанется другому содержимому того же пути,
+// даже если состояние файла с наибольшим номером уже удалено очисткой.
+func (w *Watcher) newGen(path string) uint64 {
+	w.lastGen = max(w.lastGen+1, uint64(time.Now().UnixNano()))
+	w.gens[path] = w.lastGen
+	return w.lastGen
+}
+
+// setState меняет состояние файла и отмечает его для сохранения (вызывается под w.mu)
+func (w *Watcher) setState(path string, state storage.FileState) {
+	w.processed[path] = state
+	w.dirty[path] = struct{}{}
+}
+
+// dropState удаляет состояние файла и отмечает его для сохранения (вызывается под w.mu)
+func (w *Watcher) dropState(path string) {
+	delete(w.processed, path)
+	w.dirty[path] = struct{}{}
+}
+
+// SaveProcessed сохраняет в ProcessedStore состояния, изменившиеся после прошлого сохранения.
+// Вызывается и после остановки batcher-а, чтобы сохранить состояние файлов, открытых после последней фиксации.
+func (w *Watcher) SaveProcessed() {
+	w.saveMu.Lock()
+	defer w.saveMu.Unlock()
+	w.mu.Lock()
+	changed := make(map[string]storage.FileState)
+	var removed []string
+	for path := range w.dirty {
+		if state, ok := w.processed[path]; ok {
+			changed[path] = state
+		} else {
+			removed = append(removed, path)
+		}
+	}
+	w.dirty = make(map[string]struct{})
+	w.mu.Unlock()
+	if len(changed) == 0 && len(removed) == 0 {
+		return
+	}
+	if err := w.store.Save(changed, removed); err != nil {
+		w.cfg.Logger.Error("Не удалось сохранить processed_files", zap.Error(err))
+		// несохранённые изменения уйдут со следующим сохранением
+		w.mu.Lock()
+		for path := range changed {
+			w.dirty[path] = struct{}{}
+		}
+		for _, path := range removed {
+			w.dirty[path] = struct{}{}
+		}
+		w.mu.Unlock()
+	}
+}
+
 // runPeriodicScan периодически сканирует директории
 func (w *Watcher) runPeriodicScan() {
 	ticker := time.NewTicker(time.Duration(w.cfg.Config.RescanInterval) * time.Second)
@@ -103,7 +240,7 @@ func (w *Watcher) Start(ctx context.Context) error {
 	defer dw.Close()
 
 	// Добавляем наблюдателей для всех директорий и их родителей
-	for _, dir := range w.cfg.Config.LogDirectoryMap {
+	for _, dir := range w.logDirs() {
 		root := filepath.Dir(dir)
 		if err := w.addWatchers(root, dw); err != nil {
 			w.cfg.Logger.Debug("Ошибка при добавлении наблюдателей", zap.String("dir", root), zap.Error(err))
@@ -116,6 +253,9 @@ func (w *Watcher) Start(ctx context.Context) error {
 	// Запускаем начальное сканирование
 	w.ScanInitialFiles()
 
+	// Запускаем опрос журналов регистрации в формате SQLite
+	w.startLgdPollers()
+
 	// Запускаем обработку событий
 	go w.handleDirEvents(dw)
 
@@ -125,6 +265,9 @@ func (w *Watcher) Start(ctx context.Context) error {
 	// Запускаем периодическое сканирование
 	go w.runPeriodicScan()
 
+	// Запускаем очистку состояния удалённых файлов
+	go w.runGC()
+
 	// Периодическое сохранение processed
 	go func() {
 		ticker := time.NewTicker(30 * time.Second)
@@ -134,17 +277,13 @@ func (w *Watcher) Start(ctx context.Context) error {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				if err := w.store.Save(w.processed); err != nil {
-					w.cfg.Logger.Error("Не удалось сохранить processed_files", zap.Error(err))
-				}
+				w.SaveProcessed()
 			}
 		}
 	}()
 
 	<-ctx.Done()
 	w.cfg.Logger.Info("Watcher остановлен по сигналу shutdown")
-	if err := w.store.Save(w.processed); err != nil {
-		w.cfg.Logger.Error("Не удалось сохранить processed_files", zap.Error(err))
-	}
+	w.SaveProcessed()
 	return nil
 }
@@ -0,0 +1,351 @@
+package watcher
+
+import (
+	"1CLogPumpClickHouse/internal/config"
+	"1CLogPumpClickHouse/internal/models"
+	"1CLogPumpClickHouse/internal/storage"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newTestWatcher создаёт watcher над каталогом техжурнала dir; записи попадают в возвращаемый канал
+func newTestWatcher(t *testing.T, dir string) (*Watcher, chan models.LogEntry) {
+	t.Helper()
+	cfg := &config.Config{
+		LogDirectoryMap: map[string]string{"TL": dir},
+		FilePattern:     "*.log",
+		Tail:            config.TailConfig{MaxOpenFiles: -1, IdleTimeout: -1},
+	}
+	ch := make(chan models.LogEntry, 100)
+	w := New(Config{Config: cfg, Logger: zap.NewNop(), Store: storage.NewFileStore(filepath.Join(t.TempDir(), "processed.json"))}, ch)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	w.ctx = ctx
+	return w, ch
+}
+
+// receive ждёт n записей из канала
+func receive(t *testing.T, ch <-chan models.LogEntry, n int) []models.LogEntry {
+	t.Helper()
+	var out []models.LogEntry
+	for len(out) < n {
+		select {
+		case e := <-ch:
+			out = append(out, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("получено %d записей из %d", len(out), n)
+		}
+	}
+	return out
+}
+
+// commitEntries фиксирует записи так же, как batcher после вставки
+func commitEntries(w *Watcher, entries []models.LogEntry) {
+	offsets := make(map[models.FileGen]int64)
+	for _, e := range entries {
+		offsets[models.FileGen{File: e.File, Gen: e.Gen}] = e.End
+	}
+	w.Commit(offsets)
+}
+
+// waitFor ждёт выполнения условия
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("условие не выполнено за 5 секунд")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (w *Watcher) offsetOf(path string) (int64, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	state, ok := w.processed[path]
+	return state.Offset, ok
+}
+
+const (
+	record1 = "00:01.000001-1,CALL,0,process=rphost\r\n"
+	record2 = "00:02.000002-2,CALL,0,process=rphost\r\n"
+)
+
+func TestCommitIgnoresUnknownFilesAndStaleGenerations(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "25052607.log")
+	if err := os.WriteFile(path, []byte(record1+record2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, ch := newTestWatcher(t, dir)
+	w.startTail(path)
+	entries := receive(t, ch, 2)
+
+	w.Commit(map[models.FileGen]int64{{File: filepath.Join(dir, "other.log"), Gen: entries[0].Gen}: 100})
+	if _, ok := w.offsetOf(filepath.Join(dir, "other.log")); ok {
+		t.Error("фиксация создала состояние неизвестного файла")
+	}
+	w.Commit(map[models.FileGen]int64{{File: path, Gen: entries[0].Gen + 1}: 1000})
+	if off, _ := w.offsetOf(path); off != 0 {
+		t.Errorf("смещение чужого поколения применено: %d", off)
+	}
+	commitEntries(w, entries)
+	if off, _ := w.offsetOf(path); off != int64(len(record1+record2)) {
+		t.Errorf("смещение после фиксации %d, want %d", off, len(record1+record2))
+	}
+}
+
+func TestTruncatedFileStartsNewGeneration(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "25052607.log")
+	if err := os.WriteFile(path, []byte(record1+record2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, ch := newTestWatcher(t, dir)
+	w.startTail(path)
+	old := receive(t, ch, 2)
+
+	// файл усечён и переписан, пока записи прежнего содержимого ещё не доставлены
+	if err := os.WriteFile(path, []byte(record2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fresh := receive(t, ch, 1)
+	if fresh[0].Gen == old[0].Gen || fresh[0].Offset != 0 {
+		t.Fatalf("после усечения: поколение %d (было %d), смещение %d", fresh[0].Gen, old[0].Gen, fresh[0].Offset)
+	}
+	commitEntries(w, old)
+	if off, _ := w.offsetOf(path); off != 0 {
+		t.Errorf("записи прежнего содержимого сдвинули смещение до %d", off)
+	}
+	commitEntries(w, fresh)
+	if off, _ := w.offsetOf(path); off != int64(len(record2)) {
+		t.Errorf("смещение %d, want %d", off, len(record2))
+	}
+}
+
+func TestCommitAfterRenameDoesNotRecreateOldPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "25052607.log")
+	if err := os.WriteFile(path, []byte(record1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, ch := newTestWatcher(t, dir)
+	w.startTail(path)
+	entries := receive(t, ch, 1)
+	commitEntries(w, entries)
+
+	renamed := filepath.Join(dir, "archive", "25052607.log")
+	if err := os.MkdirAll(filepath.Dir(renamed), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path, renamed); err != nil {
+		t.Fatal(err)
+	}
+	w.stopTail(path)
+	// смещение переносится, когда чтение по старому пути завершится
+	w.startTail(renamed)
+	waitFor(t, func() bool {
+		off, ok := w.offsetOf(renamed)
+		return ok && off == int64(len(record1))
+	})
+	commitEntries(w, entries)
+	if _, ok := w.offsetOf(path); ok {
+		t.Error("фиксация восстановила состояние старого пути")
+	}
+}
+
+func TestCommitSavesOffsetsImmediately(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "25052607.log")
+	if err := os.WriteFile(path, []byte(record1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, ch := newTestWatcher(t, dir)
+	w.startTail(path)
+	commitEntries(w, receive(t, ch, 1))
+	saved, err := w.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved[path].Offset != int64(len(record1)) {
+		t.Errorf("сохранённое смещение %d, want %d", saved[path].Offset, len(record1))
+	}
+}
+
+func TestRestartWaitsForInFlightEntries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "25052607.log")
+	if err := os.WriteFile(path, []byte(record1+record2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, ch := newTestWatcher(t, dir)
+	w.startTail(path)
+	inFlight := receive(t, ch, 2)
+
+	// чтение остановлено, пока записи ещё в batcher-е: повторный запуск не должен их перечитать
+	w.stopTail(path)
+	waitFor(t, func() bool {
+		w.mu.RLock()
+		defer w.mu.RUnlock()
+		_, reading := w.files[path]
+		return !reading
+	})
+	w.startTail(path)
+	select {
+	case e := <-ch:
+		t.Fatalf("запись отправлена повторно до доставки: offset %d", e.Offset)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const record3 = "00:03.000003-3,CALL,0,process=rphost\r\n"
+	f.WriteString(record3)
+	f.Close()
+
+	commitEntries(w, inFlight)
+	next := receive(t, ch, 1)
+	if next[0].Offset != int64(len(record1+record2)) {
+		t.Errorf("после доставки чтение продолжено с %d, want %d", next[0].Offset, len(record1+record2))
+	}
+}
+
+func TestScanReopensTruncatedAndReplacedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "25052607.log")
+	if err := os.WriteFile(path, []byte(record1+record2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, ch := newTestWatcher(t, dir)
+	w.startTail(path)
+	commitEntries(w, receive(t, ch, 2))
+
+	// stop закрывает файл так же, как пул чтения неактивный файл
+	stop := func() {
+		w.stopTail(path)
+		waitFor(t, func() bool {
+			w.mu.RLock()
+			defer w.mu.RUnlock()
+			_, reading := w.files[path]
+			return !reading
+		})
+	}
+
+	// файл заменён более коротким
+	stop()
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(record2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.ScanInitialFiles()
+	got := receive(t, ch, 1)
+	if got[0].Offset != 0 || got[0].Raw != strings.TrimSuffix(record2, "\r\n") {
+		t.Fatalf("после замены прочитано %q со смещения %d", got[0].Raw, got[0].Offset)
+	}
+	commitEntries(w, got)
+
+	// по пути файл той же длины, что и зафиксированное смещение, но с другим содержимым
+	stop()
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(record1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.ScanInitialFiles()
+	got = receive(t, ch, 1)
+	if got[0].Offset != 0 || got[0].Raw != strings.TrimSuffix(record1, "\r\n") {
+		t.Fatalf("после замены файлом той же длины прочитано %q со смещения %d", got[0].Raw, got[0].Offset)
+	}
+}
+
+// recordingStore запоминает, что передано в Save
+type recordingStore struct {
+	changed []map[string]storage.FileState
+	removed [][]string
+}
+
+func (s *recordingStore) Load() (map[string]storage.FileState, error) {
+	return map[string]storage.FileState{"/logs/old.log": {Offset: 10}, "/logs/gone.log": {Offset: 20}}, nil
+}
+
+func (s *recordingStore) Save(changed map[string]storage.FileState, removed []string) error {
+	s.changed = append(s.changed, changed)
+	s.removed = append(s.removed, removed)
+	return nil
+}
+
+func TestSaveProcessedSendsOnlyChanges(t *testing.T) {
+	store := &recordingStore{}
+	w := New(Config{Config: &config.Config{}, Logger: zap.NewNop(), Store: store}, make(chan models.LogEntry))
+	w.SaveProcessed()
+	if len(store.changed) != 0 {
+		t.Fatalf("сохранено без изменений: %v", store.changed)
+	}
+	w.mu.Lock()
+	w.setState("/logs/new.log", storage.FileState{Offset: 5})
+	w.dropState("/logs/gone.log")
+	w.mu.Unlock()
+	w.SaveProcessed()
+	if len(store.changed) != 1 || len(store.changed[0]) != 1 || store.changed[0]["/logs/new.log"].Offset != 5 {
+		t.Errorf("изменённые состояния: %v", store.changed)
+	}
+	if len(store.removed) != 1 || len(store.removed[0]) != 1 || store.removed[0][0] != "/logs/gone.log" {
+		t.Errorf("удалённые состояния: %v", store.removed)
+	}
+	w.SaveProcessed()
+	if len(store.changed) != 1 {
+		t.Error("сохранённые изменения отправлены повторно")
+	}
+}
+
+func TestGenerationSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "25052607.log")
+	if err := os.WriteFile(path, []byte(record1+record2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, ch := newTestWatcher(t, dir)
+	w.startTail(path)
+	// вставка прошла, а смещение не сохранено: после перезапуска записи перечитываются
+	first := receive(t, ch, 2)
+
+	restarted := New(Config{Config: w.cfg.Config, Logger: zap.NewNop(), Store: w.store}, ch)
+	restarted.ctx = w.ctx
+	restarted.startTail(path)
+	again := receive(t, ch, 2)
+	if again[0].Gen != first[0].Gen || again[0].Offset != first[0].Offset {
+		t.Errorf("после перезапуска поколение %d (было %d), смещение %d", again[0].Gen, first[0].Gen, again[0].Offset)
+	}
+
+	// усечённый файл получает новое поколение и после перезапуска
+	restarted.stopTail(path)
+	waitFor(t, func() bool { return !restarted.isReading(path) })
+	if err := os.WriteFile(path, []byte(record1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	next := New(Config{Config: w.cfg.Config, Logger: zap.NewNop(), Store: w.store}, ch)
+	next.ctx = w.ctx
+	next.startTail(path)
+	if fresh := receive(t, ch, 1); fresh[0].Gen == first[0].Gen {
+		t.Error("усечённый файл читается в прежнем поколении")
+	}
+}
+
+func (w *Watcher) isReading(path string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	_, ok := w.files[path]
+	return ok
+}